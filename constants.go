@@ -1,5 +1,7 @@
 package vcs
 
+import "os"
+
 const (
 	GitRemoteNameOrigin   = "origin"
 	GitRemoteNameUpstream = "upstream"
@@ -34,4 +36,98 @@ const (
 const (
 	GitRefTypeBranch = "branch"
 	GitRefTypeTag    = "tag"
+	GitRefTypeRemote = "remote"
+	GitRefTypeNote   = "note"
+	GitRefTypeOther  = "other"
+	GitRefTypeCommit = "commit"
+)
+
+const (
+	GitLogLevelDebug = "debug"
+	GitLogLevelInfo  = "info"
+	GitLogLevelError = "error"
+)
+
+const (
+	GitMergeHead      = "MERGE_HEAD"
+	GitMergeMsg       = "MERGE_MSG"
+	GitMergeMode      = "MERGE_MODE"
+	GitCherryPickHead = "CHERRY_PICK_HEAD"
+	GitRevertHead     = "REVERT_HEAD"
+	GitFetchHead      = "FETCH_HEAD"
+	GitRebaseMerge    = "rebase-merge"
+	GitRebaseApply    = "rebase-apply"
+)
+
+const (
+	GitConflictStrategyOurs   = "ours"
+	GitConflictStrategyTheirs = "theirs"
+)
+
+type GitRepoState string
+
+const (
+	GitRepoStateClean         GitRepoState = "clean"
+	GitRepoStateMerging       GitRepoState = "merging"
+	GitRepoStateRebasing      GitRepoState = "rebasing"
+	GitRepoStateCherryPicking GitRepoState = "cherry_picking"
+	GitRepoStateReverting     GitRepoState = "reverting"
+	GitRepoStateConflicted    GitRepoState = "conflicted"
+)
+
+const (
+	GitSyncStatusUpToDate      = "up_to_date"
+	GitSyncStatusFastForwarded = "fast_forwarded"
+	GitSyncStatusAhead         = "ahead"
+	GitSyncStatusDiverged      = "diverged"
+)
+
+const (
+	GitDefaultRepoFileMode = os.FileMode(0644)
+	GitDefaultRepoDirMode  = os.FileMode(0755)
+	GitDefaultFileMode     = os.FileMode(0644)
+)
+
+const (
+	GitDiffLineTypeContext = "context"
+	GitDiffLineTypeAdd     = "add"
+	GitDiffLineTypeDelete  = "delete"
+)
+
+const GitDiffContextLines = 3
+
+// GitBinaryCheckSize is the number of leading bytes inspected by IsBinaryContent,
+// the same as git.
+const GitBinaryCheckSize = 8000
+
+const (
+	GitHooksDirName     = "hooks"
+	GitHookSampleSuffix = ".sample"
+)
+
+const GitDescriptionFileName = "description"
+
+const (
+	GitAttributesFileName    = ".gitattributes"
+	GitAttributeExportIgnore = "export-ignore"
+	GitAttributeValueSet     = "set"
+	GitAttributeValueUnset   = "unset"
+)
+
+const (
+	GitObjectsDirName = "objects"
+	GitPackDirName    = "pack"
+	GitPackFileExt    = ".pack"
+)
+
+const (
+	GitDiffStatusAdded    = "added"
+	GitDiffStatusModified = "modified"
+	GitDiffStatusDeleted  = "deleted"
+)
+
+const (
+	GitAutoCRLFTrue  = "true"
+	GitAutoCRLFInput = "input"
+	GitAutoCRLFFalse = "false"
 )
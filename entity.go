@@ -1,6 +1,8 @@
 package vcs
 
 import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"time"
 )
 
@@ -8,21 +10,92 @@ type GitOptions struct {
 	checkout []GitCheckoutOption
 }
 
+// GitCheckoutOptions extends git.CheckoutOptions with settings go-git does not support natively.
+type GitCheckoutOptions struct {
+	git.CheckoutOptions
+	KeepHead bool
+}
+
+// GitRewordOptions are the options of RewordCommit.
+type GitRewordOptions struct {
+	Force bool
+}
+
+// GitTagListOptions are the options of GetTagsDetailed.
+type GitTagListOptions struct {
+	Limit int
+	Skip  int
+}
+
+// GitTagCreateOptions are the options of CreateTags.
+type GitTagCreateOptions struct {
+	Atomic bool
+}
+
+// GitCommitOptions extends git.CommitOptions with settings go-git does not support natively.
+type GitCommitOptions struct {
+	git.CommitOptions
+	Atomic bool
+}
+
+// GitPullOptions extends git.PullOptions with settings go-git does not support natively.
+type GitPullOptions struct {
+	git.PullOptions
+	Tags             git.TagMode
+	ConflictStrategy string
+}
+
+// GitFetchOptions extends git.FetchOptions with settings go-git does not support natively.
+type GitFetchOptions struct {
+	git.FetchOptions
+	ShallowSince time.Time
+}
+
+// GitLogger receives events emitted by GitClient. Credentials are never passed to it.
+type GitLogger func(level, msg string, kv ...interface{})
+
+// GitProgressHandler receives progress parsed from the sideband progress stream of
+// the remote, e.g. "Counting objects:  50% (26/52)".
+type GitProgressHandler func(p GitProgress)
+
+// GitMetricsRecorder receives operation counts, latencies and errors of GitClient,
+// e.g. to export them to Prometheus through an adapter.
+type GitMetricsRecorder interface {
+	IncOp(name string)
+	ObserveDuration(name string, d time.Duration)
+	IncError(name string)
+}
+
 type GitRef struct {
-	Type      string    `json:"type"`
-	Name      string    `json:"name"`
-	FullName  string    `json:"full_name"`
-	Hash      string    `json:"hash"`
-	Timestamp time.Time `json:"timestamp"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	FullName   string    `json:"full_name"`
+	Hash       string    `json:"hash"`
+	Target     string    `json:"target,omitempty"`
+	IsSymbolic bool      `json:"is_symbolic"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// GitTagDetail is a tag with its annotation. Lightweight tags have no tagger, and
+// TaggedAt is the commit time of their target.
+type GitTagDetail struct {
+	Name             string    `json:"name"`
+	TargetCommitHash string    `json:"target_commit_hash"`
+	IsAnnotated      bool      `json:"is_annotated"`
+	TaggerName       string    `json:"tagger_name"`
+	TaggerEmail      string    `json:"tagger_email"`
+	TaggedAt         time.Time `json:"tagged_at"`
+	Message          string    `json:"message"`
 }
 
 type GitLog struct {
-	Hash        string    `json:"hash"`
-	Msg         string    `json:"msg"`
-	AuthorName  string    `json:"author_name"`
-	AuthorEmail string    `json:"author_email"`
-	Timestamp   time.Time `json:"timestamp"`
-	Refs        []GitRef  `json:"refs"`
+	Hash         string    `json:"hash"`
+	Msg          string    `json:"msg"`
+	AuthorName   string    `json:"author_name"`
+	AuthorEmail  string    `json:"author_email"`
+	Timestamp    time.Time `json:"timestamp"`
+	ParentHashes []string  `json:"parent_hashes"`
+	Refs         []GitRef  `json:"refs"`
 }
 
 type GitFileStatus struct {
@@ -34,3 +107,107 @@ type GitFileStatus struct {
 	Extra    string          `json:"extra"`
 	Children []GitFileStatus `json:"children"`
 }
+
+type GitWorktreeChange struct {
+	Path    string    `json:"path"`
+	Status  string    `json:"status"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type GitLargeObject struct {
+	Hash    string   `json:"hash"`
+	Size    int64    `json:"size"`
+	Paths   []string `json:"paths"`
+	Commits []string `json:"commits"`
+}
+
+// GitMaintenanceInfo describes the object store of a fs repo, to decide when to gc.
+// Size is the total size in bytes of loose objects and packfiles (with indexes).
+type GitMaintenanceInfo struct {
+	LooseObjects int   `json:"loose_objects"`
+	PackFiles    int   `json:"pack_files"`
+	Size         int64 `json:"size"`
+}
+
+type GitHook struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	IsSample bool   `json:"is_sample"`
+}
+
+// GitImportCommit is a commit imported by ImportCommits. Files are applied on top of
+// the parent's tree, a nil content deletes the path. An empty Parent chains the
+// commit to the previously imported one (or the branch tip for the first), and a
+// zero Committer defaults to Author.
+type GitImportCommit struct {
+	Files     map[string][]byte `json:"files"`
+	Author    object.Signature  `json:"author"`
+	Committer object.Signature  `json:"committer"`
+	Message   string            `json:"message"`
+	Parent    string            `json:"parent"`
+}
+
+// GitTagSpec is a tag created by CreateTags. A tag with a Message is annotated, by
+// Tagger or the configured user if nil; one without is lightweight.
+type GitTagSpec struct {
+	Name      string            `json:"name"`
+	TargetRef string            `json:"target_ref"`
+	Message   string            `json:"message"`
+	Tagger    *object.Signature `json:"tagger"`
+}
+
+type GitSyncResult struct {
+	Status string `json:"status"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+	Hash   string `json:"hash"`
+}
+
+type GitCommitMessageVars struct {
+	Branch    string
+	FileCount int
+	Timestamp time.Time
+}
+
+type GitDiffFile struct {
+	Path        string        `json:"path"`
+	OldPath     string        `json:"old_path"`
+	Status      string        `json:"status"`
+	OldMode     string        `json:"old_mode"`
+	NewMode     string        `json:"new_mode"`
+	ModeChanged bool          `json:"mode_changed"`
+	IsBinary    bool          `json:"is_binary"`
+	Hunks       []GitDiffHunk `json:"hunks"`
+}
+
+type GitDiffHunk struct {
+	OldStart int           `json:"old_start"`
+	OldLines int           `json:"old_lines"`
+	NewStart int           `json:"new_start"`
+	NewLines int           `json:"new_lines"`
+	Lines    []GitDiffLine `json:"lines"`
+}
+
+type GitDiffLine struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+type GitRecoveryPoint struct {
+	Hash      string    `json:"hash"`
+	Msg       string    `json:"msg"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type GitProgress struct {
+	Stage   string `json:"stage"`
+	Current int    `json:"current"`
+	Total   int    `json:"total"`
+	Percent int    `json:"percent"`
+	Done    bool   `json:"done"`
+}
+
+type GitObjectCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
@@ -1,6 +1,10 @@
 package vcs
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strings"
+)
 
 var (
 	ErrInvalidArgsLength               = errors.New("invalid arguments length")
@@ -8,9 +12,56 @@ var (
 	ErrInvalidAuthType                 = errors.New("invalid auth type")
 	ErrInvalidOptions                  = errors.New("invalid options")
 	ErrRepoAlreadyExists               = errors.New("repo already exists")
+	ErrNestedRepo                      = errors.New("repo nested inside an existing repo")
 	ErrInvalidRepoPath                 = errors.New("invalid repo path")
+	ErrRepoPathNotExists               = errors.New("repo path not exists")
+	ErrPathOutsideRepo                 = errors.New("path outside of repo")
 	ErrUnableToGetCurrentBranch        = errors.New("unable to get current branch")
 	ErrUnableToCloneWithEmptyRemoteUrl = errors.New("unable to clone with empty remote url")
 	ErrInvalidHeadRef                  = errors.New("invalid head ref")
 	ErrNoMatchedRemoteBranch           = errors.New("no matched remote branch")
+	ErrNoMatchedPaths                  = errors.New("no paths matched")
+	ErrNotMemRepo                      = errors.New("not a mem repo")
+	ErrNotFsRepo                       = errors.New("not a fs repo")
+	ErrFileNotFoundInTree              = errors.New("file not found in tree")
+	ErrNoConflict                      = errors.New("no conflict")
+	ErrUnresolvedConflicts             = errors.New("unresolved conflicts")
+	ErrNoCommits                       = errors.New("no commits yet")
+	ErrEmptyCommitMessage              = errors.New("empty commit message")
+	ErrNoMergeInProgress               = errors.New("no merge in progress")
+	ErrWorktreeNotClean                = errors.New("worktree not clean")
+	ErrConfigNotFound                  = errors.New("config not found")
+	ErrNoUpstream                      = errors.New("no upstream configured")
+	ErrInvalidSignKey                  = errors.New("invalid sign key")
+	ErrCommitNotSigned                 = errors.New("commit not signed")
+	ErrCommitPushed                    = errors.New("commit already pushed")
+	ErrNotAncestorOfHead               = errors.New("commit not an ancestor of HEAD")
+	ErrSquashMergeCommit               = errors.New("cannot squash merge commits")
+	ErrTagNotAnnotated                 = errors.New("tag not annotated")
+	ErrTagNotSigned                    = errors.New("tag not signed")
+	ErrObjectNotFound                  = errors.New("object not found")
+	ErrTagNotCommit                    = errors.New("tag does not point to a commit")
+	ErrPathTooLong                     = errors.New("path too long")
+	ErrDubiousOwnership                = errors.New("dubious ownership of repo")
+	ErrInvalidBundle                   = errors.New("invalid bundle")
+	ErrBundlePrerequisites             = errors.New("bundle prerequisites not supported")
+	ErrFetchCommitNotSupported         = errors.New("server does not allow fetching a commit by hash")
+	ErrGitBinaryNotFound               = errors.New("git binary not found")
+	ErrHttpRedirectNotAllowed          = errors.New("http redirect not allowed")
 )
+
+// GitTagErrors maps the names of the tags CreateTags failed to create to the errors.
+type GitTagErrors map[string]error
+
+func (e GitTagErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e[name].Error()
+	}
+	return "failed to create tags: " + strings.Join(msgs, "; ")
+}
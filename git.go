@@ -1,46 +1,109 @@
 package vcs
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/apex/log"
 	"github.com/crawlab-team/go-trace"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"golang.org/x/crypto/ssh"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
-	"regexp"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
-var headRefRegexp, _ = regexp.Compile("^ref: (.*)")
-
 type GitClient struct {
 	// settings
-	path           string
-	remoteUrl      string
-	isMem          bool
-	authType       GitAuthType
-	username       string
-	password       string
-	privateKey     string
-	privateKeyPath string
-	defaultBranch  string
+	path                  string
+	remoteUrl             string
+	noAutoRemote          bool
+	isMem                 bool
+	authType              GitAuthType
+	username              string
+	password              string
+	privateKey            string
+	privateKeyPath        string
+	defaultBranch         string
+	repoFileMode          os.FileMode
+	repoDirMode           os.FileMode
+	logger                GitLogger
+	followRedirects       bool
+	commitMessageTemplate string
+	signKey               []byte
+	signKeyPath           string
+	signKeyPassphrase     string
+	signEntity            *openpgp.Entity
+	autoCRLF              string
+	objectCacheSize       cache.FileSize
+	followSymlinks        bool
+	mailmap               map[string]string
+	trustedPaths          []string
+	ownerUid              *int
+	disableHooks          bool
+	disposeRetryAttempts  int
+	disposeRetryDelay     time.Duration
+	httpHeaders           map[string]string
+	httpTransport         transport.Transport
+	remoteFetchRefSpecs   []config.RefSpec
+	noNestedRepo          bool
+	noCreate              bool
+	metrics               GitMetricsRecorder
+	defaultFileMode       os.FileMode
+	opMu                  sync.Mutex
+	opSeq                 int
+	opCancels             map[int]context.CancelFunc
 
 	// internals
-	r *git.Repository
+	r        *git.Repository
+	realPath string
 }
 
 func (c *GitClient) Init() (err error) {
+	defer c.recordOp("init")(&err)
+
+	// serialize concurrent init of the same path
+	unlock := lockInit(c.getInitLockKey())
+	defer unlock()
+
+	// sign key (parsed and decrypted once, reporting a bad key or passphrase early)
+	if err := c.loadSignKey(); err != nil {
+		return err
+	}
+
 	initType := c.getInitType()
 	switch initType {
 	case GitInitTypeFs:
@@ -52,13 +115,43 @@ func (c *GitClient) Init() (err error) {
 		return err
 	}
 
+	// object cache
+	if c.objectCacheSize > 0 {
+		if s, ok := c.r.Storer.(*filesystem.Storage); ok {
+			c.r.Storer = newGitObjectCacheStorage(s, c.objectCacheSize)
+		}
+	}
+
+	// hooks
+	if c.disableHooks {
+		if err := c.RemoveHooks(); err != nil {
+			return err
+		}
+	}
+
+	// line endings (resolved once from the config, which may have been set outside)
+	if c.autoCRLF != "" {
+		if err := c.setAutoCRLF(c.autoCRLF); err != nil {
+			return err
+		}
+	}
+	c.autoCRLF, err = c.getAutoCRLF()
+	if err != nil {
+		return err
+	}
+	if c.autoCRLF == GitAutoCRLFTrue || c.autoCRLF == GitAutoCRLFInput {
+		if err := c.normalizeWorktreeLineEndings(); err != nil {
+			return err
+		}
+	}
+
 	// if remote url is not empty and no remote exists
 	// create default remote and pull from remote url
 	remotes, err := c.r.Remotes()
 	if err != nil {
 		return err
 	}
-	if c.remoteUrl != "" && len(remotes) == 0 {
+	if c.remoteUrl != "" && !c.noAutoRemote && len(remotes) == 0 {
 		// attempt to get default remote
 		if _, err := c.r.Remote(GitRemoteNameOrigin); err != nil {
 			if err != git.ErrRemoteNotFound {
@@ -67,7 +160,7 @@ func (c *GitClient) Init() (err error) {
 			err = nil
 
 			// create default remote
-			if err := c.createRemote(GitRemoteNameOrigin, c.remoteUrl); err != nil {
+			if err := c.createRemote(GitRemoteNameOrigin, c.remoteUrl, c.remoteFetchRefSpecs); err != nil {
 				return err
 			}
 
@@ -78,17 +171,78 @@ func (c *GitClient) Init() (err error) {
 			//if err := c.Pull(opts...); err != nil {
 			//	return err
 			//}
+
+			// check out the remote default branch (best effort, the remote may be unreachable yet)
+			if err := c.checkoutRemoteDefaultBranch(GitRemoteNameOrigin); err != nil {
+				c.logEvent(GitLogLevelError, "check out remote default branch failed", "error", err.Error())
+			}
 		}
 	}
 
 	return nil
 }
 
+// Reinit re-runs the remote setup of Init on an initialized client, e.g. once a remote
+// unreachable at construction is back: origin is created or pointed to the current
+// remote url, then the remote default branch is checked out, or the current branch
+// pulled if there are commits already. It can be called repeatedly.
+func (c *GitClient) Reinit() (err error) {
+	if c.r == nil {
+		return c.Init()
+	}
+	if c.remoteUrl == "" || c.noAutoRemote {
+		return nil
+	}
+
+	// origin remote (created if missing, pointed to the current remote url otherwise)
+	if _, err := c.r.Remote(GitRemoteNameOrigin); err != nil {
+		if err != git.ErrRemoteNotFound {
+			return trace.TraceError(err)
+		}
+		if err := c.createRemote(GitRemoteNameOrigin, c.remoteUrl, c.remoteFetchRefSpecs); err != nil {
+			return err
+		}
+	} else {
+		cfg, err := c.r.Config()
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		remoteCfg := cfg.Remotes[GitRemoteNameOrigin]
+		if len(remoteCfg.URLs) != 1 || remoteCfg.URLs[0] != c.remoteUrl {
+			remoteCfg.URLs = []string{c.remoteUrl}
+			if err := c.r.SetConfig(cfg); err != nil {
+				return trace.TraceError(err)
+			}
+		}
+	}
+
+	// sync
+	if _, err := c.r.Head(); err == plumbing.ErrReferenceNotFound {
+		return c.checkoutRemoteDefaultBranch(GitRemoteNameOrigin)
+	} else if err != nil {
+		return trace.TraceError(err)
+	}
+	return c.Pull(WithRemoteNamePull(GitRemoteNameOrigin))
+}
+
 func (c *GitClient) Dispose() (err error) {
 	switch c.getInitType() {
 	case GitInitTypeFs:
-		if err := os.RemoveAll(c.path); err != nil {
-			return trace.TraceError(err)
+		// release open file handles (e.g. packfiles), which block removal on windows
+		if c.r != nil {
+			if closer, ok := c.r.Storer.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+
+		// a symlinked repo path only loses the link unless symlinks are followed
+		if c.followSymlinks && c.realPath != "" {
+			if err := c.removeAll(c.realPath); err != nil {
+				return trace.TraceError(getFsError(err))
+			}
+		}
+		if err := c.removeAll(getLongPath(c.path)); err != nil {
+			return trace.TraceError(getFsError(err))
 		}
 	case GitInitTypeMem:
 		GitMemStorages.Delete(c.path)
@@ -98,6 +252,8 @@ func (c *GitClient) Dispose() (err error) {
 }
 
 func (c *GitClient) Checkout(opts ...GitCheckoutOption) (err error) {
+	defer c.recordOp("checkout")(&err)
+
 	// worktree
 	wt, err := c.r.Worktree()
 	if err != nil {
@@ -105,64 +261,93 @@ func (c *GitClient) Checkout(opts ...GitCheckoutOption) (err error) {
 	}
 
 	// apply options
-	o := &git.CheckoutOptions{}
+	o := &GitCheckoutOptions{}
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	// current HEAD (restored after checkout if kept)
+	headRef, err := c.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
 	// checkout to the branch
-	if err := wt.Checkout(o); err != nil {
+	if err := wt.Checkout(&o.CheckoutOptions); err != nil {
 		return trace.TraceError(err)
 	}
 
+	// keep HEAD
+	if o.KeepHead {
+		if err := c.r.Storer.SetReference(headRef); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
 	return nil
 }
 
+// Commit commits the staged changes. Unlike go-git, which commits an unchanged tree,
+// it fails with git.ErrEmptyCommit if the index matches the tree of HEAD, like git;
+// pass WithAllowEmpty(true) to commit anyway.
 func (c *GitClient) Commit(msg string, opts ...GitCommitOption) (err error) {
-	// worktree
-	wt, err := c.r.Worktree()
-	if err != nil {
-		return trace.TraceError(err)
-	}
+	defer c.recordOp("commit")(&err)
 
 	// apply options
-	o := &git.CommitOptions{}
+	o := &GitCommitOptions{}
 	for _, opt := range opts {
 		opt(o)
 	}
 
-	// commit
-	if _, err := wt.Commit(msg, o); err != nil {
-		return trace.TraceError(err)
-	}
-
-	return nil
+	_, err = c.commit(msg, o)
+	return err
 }
 
 func (c *GitClient) Pull(opts ...GitPullOption) (err error) {
+	defer c.recordOp("pull")(&err)
+
 	// worktree
 	wt, err := c.r.Worktree()
 	if err != nil {
 		return trace.TraceError(err)
 	}
 
-	// auth
-	auth, err := c.getGitAuth()
+	// apply options
+	o := &GitPullOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// auth (for the url of the remote, the client's auth taking precedence)
+	auth, err := c.getGitAuth(c.getRemoteUrl(o.RemoteName))
 	if err != nil {
 		return err
 	}
 	if auth != nil {
-		opts = append(opts, WithAuthPull(auth))
+		o.Auth = auth
 	}
 
-	// apply options
-	o := &git.PullOptions{}
-	for _, opt := range opts {
-		opt(o)
-	}
+	// limit concurrent ssh connections per host
+	release := acquireSSHConnection(c.getRemoteUrl(o.RemoteName))
+	defer release()
 
-	// pull
-	if err := wt.Pull(o); err != nil {
+	// pull (go-git's pull does not support tag modes, so fetch and fast-forward explicitly)
+	ctx, done := c.startOperation()
+	defer done()
+	c.logEvent(GitLogLevelInfo, "pull started", "remote", o.RemoteName, "branch", o.ReferenceName.Short())
+	if o.Tags != git.InvalidTagMode {
+		err = c.fetchAndFastForward(ctx, o)
+	} else {
+		err = wt.PullContext(ctx, &o.PullOptions)
+	}
+	if err == git.ErrNonFastForwardUpdate && o.ConflictStrategy != "" {
+		err = c.pullMerge(o)
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	c.logResult("pull finished", err)
+	if err != nil {
 		if err == transport.ErrEmptyRemoteRepository {
 			return nil
 		}
@@ -181,24 +366,164 @@ func (c *GitClient) Pull(opts ...GitPullOption) (err error) {
 	return nil
 }
 
-func (c *GitClient) Push(opts ...GitPushOption) (err error) {
-	// auth
-	auth, err := c.getGitAuth()
+func (c *GitClient) Fetch(opts ...GitFetchOption) (err error) {
+	defer c.recordOp("fetch")(&err)
+
+	// apply options
+	o := &GitFetchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// auth (for the url of the remote, the client's auth taking precedence)
+	remoteUrl := c.getOperationRemoteUrl(o.RemoteName, o.RemoteURL)
+	auth, err := c.getGitAuth(remoteUrl)
 	if err != nil {
 		return err
 	}
 	if auth != nil {
-		opts = append(opts, WithAuthPush(auth))
+		o.Auth = auth
+	}
+
+	// limit concurrent ssh connections per host
+	release := acquireSSHConnection(remoteUrl)
+	defer release()
+
+	// fetch
+	ctx, done := c.startOperation()
+	defer done()
+	c.logEvent(GitLogLevelInfo, "fetch started", "remote", o.RemoteName)
+	if !o.ShallowSince.IsZero() {
+		err = c.fetchShallowSince(ctx, o)
+	} else {
+		err = c.r.FetchContext(ctx, &o.FetchOptions)
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	c.logResult("fetch finished", err)
+	if err != nil {
+		if err == transport.ErrEmptyRemoteRepository {
+			return nil
+		}
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		if err == git.ErrExactSHA1NotSupported {
+			return trace.TraceError(ErrFetchCommitNotSupported)
+		}
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) Sync(remoteName, branch string) (res GitSyncResult, err error) {
+	// remote name
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
+	}
+
+	// branch
+	currentBranch, err := c.GetCurrentBranch()
+	if err != nil {
+		return res, err
+	}
+	if branch == "" {
+		branch = currentBranch
+	}
+
+	// fetch
+	if err := c.Fetch(WithRemoteNameFetch(remoteName)); err != nil {
+		return res, err
+	}
+
+	// local branch ref
+	localRef, err := c.r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return res, trace.TraceError(err)
+	}
+	res.Hash = localRef.Hash().String()
+
+	// remote-tracking ref
+	remoteRef, err := c.r.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+	if err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			res.Status = GitSyncStatusAhead
+			return res, nil
+		}
+		return res, trace.TraceError(err)
+	}
+
+	// ahead and behind counts
+	aheadLogs, err := c.getLogsBetween(remoteRef.Hash(), localRef.Hash())
+	if err != nil {
+		return res, err
+	}
+	behindLogs, err := c.getLogsBetween(localRef.Hash(), remoteRef.Hash())
+	if err != nil {
+		return res, err
+	}
+	res.Ahead = len(aheadLogs)
+	res.Behind = len(behindLogs)
+
+	switch {
+	case res.Ahead == 0 && res.Behind == 0:
+		res.Status = GitSyncStatusUpToDate
+	case res.Behind == 0:
+		res.Status = GitSyncStatusAhead
+	case res.Ahead == 0:
+		// fast-forward
+		if branch == currentBranch {
+			err = c.fastForward(remoteRef.Hash())
+		} else {
+			err = c.r.Storer.SetReference(plumbing.NewHashReference(localRef.Name(), remoteRef.Hash()))
+		}
+		if err != nil {
+			return res, trace.TraceError(err)
+		}
+		res.Status = GitSyncStatusFastForwarded
+		res.Hash = remoteRef.Hash().String()
+	default:
+		res.Status = GitSyncStatusDiverged
 	}
 
+	return res, nil
+}
+
+func (c *GitClient) Push(opts ...GitPushOption) (err error) {
+	defer c.recordOp("push")(&err)
+
 	// apply options
 	o := &git.PushOptions{}
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	// auth (for the url of the remote, the client's auth taking precedence)
+	remoteUrl := c.getOperationRemoteUrl(o.RemoteName, o.RemoteURL)
+	auth, err := c.getGitAuth(remoteUrl)
+	if err != nil {
+		return err
+	}
+	if auth != nil {
+		o.Auth = auth
+	}
+
+	// limit concurrent ssh connections per host
+	release := acquireSSHConnection(remoteUrl)
+	defer release()
+
 	// push
-	if err := c.r.Push(o); err != nil {
+	ctx, done := c.startOperation()
+	defer done()
+	c.logEvent(GitLogLevelInfo, "push started", "remote", o.RemoteName)
+	err = c.r.PushContext(ctx, o)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	c.logResult("push finished", err)
+	if err != nil {
 		return trace.TraceError(err)
 	}
 
@@ -206,6 +531,8 @@ func (c *GitClient) Push(opts ...GitPushOption) (err error) {
 }
 
 func (c *GitClient) Reset(opts ...GitResetOption) (err error) {
+	defer c.recordOp("reset")(&err)
+
 	// apply options
 	o := &git.ResetOptions{
 		Mode: git.HardReset,
@@ -250,6 +577,8 @@ func (c *GitClient) CheckoutBranch(branch string, opts ...GitCheckoutOption) (er
 }
 
 func (c *GitClient) CheckoutBranchWithRemote(branch, remote string, ref *plumbing.Reference, opts ...GitCheckoutOption) (err error) {
+	defer c.recordOp("checkout_branch")(&err)
+
 	if remote == "" {
 		remote = GitRemoteNameOrigin
 	}
@@ -288,6 +617,8 @@ func (c *GitClient) CheckoutBranchWithRemote(branch, remote string, ref *plumbin
 }
 
 func (c *GitClient) CheckoutHash(hash string, opts ...GitCheckoutOption) (err error) {
+	defer c.recordOp("checkout_hash")(&err)
+
 	// add to options
 	opts = append(opts, WithHash(hash))
 
@@ -315,19 +646,54 @@ func (c *GitClient) MoveBranch(from, to string) (err error) {
 	return nil
 }
 
+// CommitAll stages all changes, including untracked files, and commits them. It fails
+// with git.ErrEmptyCommit if nothing changed, unless WithAllowEmpty(true) is passed.
 func (c *GitClient) CommitAll(msg string, opts ...GitCommitOption) (err error) {
+	_, err = c.CommitAllWithHash(msg, opts...)
+	return err
+}
+
+// CommitAllWithHash stages all files, commits and returns the hash of the new commit.
+func (c *GitClient) CommitAllWithHash(msg string, opts ...GitCommitOption) (hash string, err error) {
+	defer c.recordOp("commit_all")(&err)
+
 	// worktree
 	wt, err := c.r.Worktree()
 	if err != nil {
-		return trace.TraceError(err)
+		return "", trace.TraceError(err)
+	}
+
+	// apply options
+	o := &GitCommitOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// index before staging
+	var idxData []byte
+	if o.Atomic {
+		idxData, err = c.encodeIndex()
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// add all files
 	if _, err := wt.Add("."); err != nil {
-		return trace.TraceError(err)
+		return "", trace.TraceError(err)
 	}
 
-	return c.Commit(msg, opts...)
+	// commit (restore the index on failure if atomic)
+	h, err := c.commit(msg, o)
+	if err != nil {
+		if o.Atomic {
+			if restoreErr := c.decodeIndex(idxData); restoreErr != nil {
+				return "", restoreErr
+			}
+		}
+		return "", err
+	}
+	return h.String(), nil
 }
 
 func (c *GitClient) GetLogs() (logs []GitLog, err error) {
@@ -338,14 +704,7 @@ func (c *GitClient) GetLogs() (logs []GitLog, err error) {
 		return nil, trace.TraceError(err)
 	}
 	if err := iter.ForEach(func(commit *object.Commit) error {
-		log := GitLog{
-			Hash:        commit.Hash.String(),
-			Msg:         commit.Message,
-			AuthorName:  commit.Author.Name,
-			AuthorEmail: commit.Author.Email,
-			Timestamp:   commit.Author.When,
-		}
-		logs = append(logs, log)
+		logs = append(logs, c.getGitLog(commit))
 		return nil
 	}); err != nil {
 		return nil, trace.TraceError(err)
@@ -396,274 +755,555 @@ func (c *GitClient) GetLogsWithRefs() (logs []GitLog, err error) {
 	return logs, nil
 }
 
-func (c *GitClient) GetRepository() (r *git.Repository) {
-	return c.r
-}
-
-func (c *GitClient) GetPath() (path string) {
-	return c.path
-}
-
-func (c *GitClient) SetPath(path string) {
-	c.path = path
-}
-
-func (c *GitClient) GetRemoteUrl() (path string) {
-	return c.remoteUrl
-}
+func (c *GitClient) GetDirLogs(dir string, opts ...GitLogOption) (logs []GitLog, err error) {
+	// log options
+	o := &git.LogOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
-func (c *GitClient) SetRemoteUrl(url string) {
-	c.remoteUrl = url
-}
+	// directory prefix
+	prefix := strings.Trim(dir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
 
-func (c *GitClient) GetIsMem() (isMem bool) {
-	return c.isMem
-}
+	// iterate commits
+	iter, err := c.r.Log(o)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(commit *object.Commit) error {
+		ok, err := c.isCommitTouchingPrefix(commit, prefix)
+		if err != nil {
+			return err
+		}
+		if ok {
+			logs = append(logs, c.getGitLog(commit))
+		}
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
 
-func (c *GitClient) SetIsMem(isMem bool) {
-	c.isMem = isMem
+	return logs, nil
 }
 
-func (c *GitClient) GetAuthType() (authType GitAuthType) {
-	return c.authType
-}
+func (c *GitClient) GetLogsJSON(opts ...GitLogOption) (data []byte, err error) {
+	// log options
+	o := &git.LogOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
-func (c *GitClient) SetAuthType(authType GitAuthType) {
-	c.authType = authType
-}
+	// iterate commits and encode each log into the array
+	iter, err := c.r.Log(o)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	if err := iter.ForEach(func(commit *object.Commit) error {
+		logData, err := json.Marshal(c.getGitLog(commit))
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(logData)
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	buf.WriteByte(']')
 
-func (c *GitClient) GetUsername() (username string) {
-	return c.username
+	return buf.Bytes(), nil
 }
 
-func (c *GitClient) SetUsername(username string) {
-	c.username = username
+func (c *GitClient) GetCommit(ref string) (l *GitLog, err error) {
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	gitLog := c.getGitLog(commit)
+	return &gitLog, nil
 }
 
-func (c *GitClient) GetPassword() (password string) {
-	return c.password
-}
+// FindLargeObjects returns the blobs in the object store (packed or loose) larger
+// than thresholdBytes, largest first, with the paths and commits they appear in.
+func (c *GitClient) FindLargeObjects(thresholdBytes int64) (objects []GitLargeObject, err error) {
+	// large blobs
+	large := map[plumbing.Hash]*GitLargeObject{}
+	iter, err := c.r.Storer.IterEncodedObjects(plumbing.BlobObject)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if obj.Size() > thresholdBytes {
+			large[obj.Hash()] = &GitLargeObject{Hash: obj.Hash().String(), Size: obj.Size()}
+		}
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if len(large) == 0 {
+		return []GitLargeObject{}, nil
+	}
 
-func (c *GitClient) SetPassword(password string) {
-	c.password = password
-}
+	// paths and commits
+	logIter, err := c.r.Log(&git.LogOptions{All: true})
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	memo := map[plumbing.Hash][]gitTreeBlob{}
+	paths := map[plumbing.Hash]map[string]bool{}
+	if err := logIter.ForEach(func(commit *object.Commit) error {
+		blobs, err := c.getLargeTreeBlobs(commit.TreeHash, large, memo)
+		if err != nil {
+			return err
+		}
+		seen := map[plumbing.Hash]bool{}
+		for _, b := range blobs {
+			if paths[b.hash] == nil {
+				paths[b.hash] = map[string]bool{}
+			}
+			if !paths[b.hash][b.path] {
+				paths[b.hash][b.path] = true
+				large[b.hash].Paths = append(large[b.hash].Paths, b.path)
+			}
+			if !seen[b.hash] {
+				seen[b.hash] = true
+				large[b.hash].Commits = append(large[b.hash].Commits, commit.Hash.String())
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
 
-func (c *GitClient) GetPrivateKey() (key string) {
-	return c.privateKey
-}
+	// sort
+	for _, o := range large {
+		sort.Strings(o.Paths)
+		objects = append(objects, *o)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Size != objects[j].Size {
+			return objects[i].Size > objects[j].Size
+		}
+		return objects[i].Hash < objects[j].Hash
+	})
 
-func (c *GitClient) SetPrivateKey(key string) {
-	c.privateKey = key
+	return objects, nil
 }
 
-func (c *GitClient) GetPrivateKeyPath() (path string) {
-	return c.privateKeyPath
+// GetMaintenanceInfo counts the loose objects and packfiles of the repo and their
+// total size (fs repos only, ErrNotFsRepo otherwise).
+func (c *GitClient) GetMaintenanceInfo() (info GitMaintenanceInfo, err error) {
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return info, trace.TraceError(ErrNotFsRepo)
+	}
+	dotGitFs := fsStorage.Filesystem()
+
+	// object directories
+	dirs, err := dotGitFs.ReadDir(GitObjectsDirName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return info, nil
+		}
+		return info, trace.TraceError(err)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		files, err := dotGitFs.ReadDir(dotGitFs.Join(GitObjectsDirName, dir.Name()))
+		if err != nil {
+			return info, trace.TraceError(err)
+		}
+		switch {
+		case dir.Name() == GitPackDirName:
+			// packfiles and their indexes
+			for _, f := range files {
+				if f.IsDir() {
+					continue
+				}
+				if strings.HasSuffix(f.Name(), GitPackFileExt) {
+					info.PackFiles++
+				}
+				info.Size += f.Size()
+			}
+		case len(dir.Name()) == 2:
+			// loose objects (fan-out by the first two hex digits)
+			for _, f := range files {
+				if f.IsDir() {
+					continue
+				}
+				info.LooseObjects++
+				info.Size += f.Size()
+			}
+		}
+	}
+
+	return info, nil
 }
 
-func (c *GitClient) SetPrivateKeyPath(path string) {
-	c.privateKeyPath = path
+// GC packs loose objects and prunes unreachable ones with "git gc" (fs repos only).
+// It needs the git binary (see SetGitBinaryPath).
+func (c *GitClient) GC() (err error) {
+	if _, err := c.runGit("gc", "--quiet"); err != nil {
+		return err
+	}
+
+	// reload the packfile indexes cached by the storage
+	if s, ok := c.r.Storer.(interface{ Reindex() }); ok {
+		s.Reindex()
+	}
+
+	return nil
 }
 
-func (c *GitClient) GetCurrentBranch() (branch string, err error) {
-	// attempt to get branch from .git/HEAD
-	headRefStr, err := c.getHeadRef()
+func (c *GitClient) GetRootCommits() (logs []GitLog, err error) {
+	iter, err := c.r.Log(&git.LogOptions{
+		All: true,
+	})
 	if err != nil {
-		return "", err
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(commit *object.Commit) error {
+		if commit.NumParents() == 0 {
+			logs = append(logs, c.getGitLog(commit))
+		}
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
 	}
+	return logs, nil
+}
 
-	// if .git/HEAD points to refs/heads/master, return branch as master
-	if headRefStr == plumbing.Master.String() {
-		return GitBranchNameMaster, nil
+func (c *GitClient) GetUnpushedCommits(remoteName, branch string) (logs []GitLog, err error) {
+	// remote name
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
 	}
 
-	// attempt to get head ref
-	headRef, err := c.r.Head()
+	// branch
+	if branch == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// local branch ref
+	localRef, err := c.r.Reference(plumbing.NewBranchReferenceName(branch), true)
 	if err != nil {
-		return "", trace.TraceError(err)
+		return nil, trace.TraceError(err)
 	}
-	if !headRef.Name().IsBranch() {
-		return "", trace.TraceError(ErrUnableToGetCurrentBranch)
+
+	// remote-tracking ref (absent if the branch has never been pushed)
+	var remoteHash plumbing.Hash
+	remoteRef, err := c.r.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+	if err == nil {
+		remoteHash = remoteRef.Hash()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, trace.TraceError(err)
 	}
 
-	return headRef.Name().Short(), nil
+	return c.getLogsBetween(remoteHash, localRef.Hash())
 }
 
-func (c *GitClient) GetCurrentBranchRef() (ref *GitRef, err error) {
-	currentBranch, err := c.GetCurrentBranch()
-	if err != nil {
-		return nil, err
+// GetCommitsBetweenTags returns the commits reachable from toTag but not from
+// fromTag, newest first. An empty fromTag returns the full history of toTag.
+func (c *GitClient) GetCommitsBetweenTags(fromTag, toTag string) (logs []GitLog, err error) {
+	// from (annotated tags are peeled to their commits)
+	var fromHash plumbing.Hash
+	if fromTag != "" {
+		fromCommit, err := c.getCommitByRef(plumbing.NewTagReferenceName(fromTag).String())
+		if err != nil {
+			return nil, err
+		}
+		fromHash = fromCommit.Hash
 	}
-	branches, err := c.GetBranches()
+
+	// to
+	toCommit, err := c.getCommitByRef(plumbing.NewTagReferenceName(toTag).String())
 	if err != nil {
 		return nil, err
 	}
-	for _, branch := range branches {
-		if branch.Name == currentBranch {
-			return &branch, nil
+
+	return c.getLogsBetween(fromHash, toCommit.Hash)
+}
+
+// IsRemoteRewritten fetches the remote and reports whether the history of the
+// remote branch was rewritten (force-pushed), i.e. the previous remote-tracking
+// tip is no longer an ancestor of the fetched one.
+func (c *GitClient) IsRemoteRewritten(remoteName, branch string) (ok bool, err error) {
+	// remote name
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
+	}
+
+	// branch
+	if branch == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return false, err
 		}
 	}
-	return nil, trace.TraceError(ErrUnableToGetCurrentBranch)
-}
 
-func (c *GitClient) GetBranches() (branches []GitRef, err error) {
-	iter, err := c.r.Branches()
+	// previous remote-tracking tip (nothing to compare if never fetched)
+	remoteRefName := plumbing.NewRemoteReferenceName(remoteName, branch)
+	oldRef, err := c.r.Reference(remoteRefName, true)
 	if err != nil {
-		return nil, trace.TraceError(err)
+		if err == plumbing.ErrReferenceNotFound {
+			return false, c.Fetch(WithRemoteNameFetch(remoteName))
+		}
+		return false, trace.TraceError(err)
 	}
 
-	_ = iter.ForEach(func(r *plumbing.Reference) error {
-		branches = append(branches, GitRef{
-			Type: GitRefTypeBranch,
-			Name: r.Name().Short(),
-			Hash: r.Hash().String(),
-		})
-		return nil
-	})
+	// fetch
+	if err := c.Fetch(WithRemoteNameFetch(remoteName)); err != nil {
+		return false, err
+	}
 
-	return branches, nil
+	// new remote-tracking tip
+	newRef, err := c.r.Reference(remoteRefName, true)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+
+	// rewritten if the old tip is not reachable from the new one
+	isAncestor, err := c.isAncestor(oldRef.Hash(), newRef.Hash())
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return !isAncestor, nil
 }
 
-func (c *GitClient) GetRemoteRefs(remoteName string) (gitRefs []GitRef, err error) {
+// PruneRemote deletes the remote-tracking branches of remoteName whose branches
+// no longer exist on the remote and returns their short names.
+func (c *GitClient) PruneRemote(remoteName string) (pruned []string, err error) {
+	// remote name
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
+	}
+
 	// remote
 	r, err := c.r.Remote(remoteName)
 	if err != nil {
-		if err == git.ErrRemoteNotFound {
-			return nil, nil
-		}
 		return nil, trace.TraceError(err)
 	}
 
 	// auth
-	auth, err := c.getGitAuth()
+	auth, err := c.getGitAuth(c.getRemoteUrl(remoteName))
 	if err != nil {
 		return nil, err
 	}
 
-	// refs
-	refs, err := r.List(&git.ListOptions{Auth: auth})
-	if err != nil {
-		if err != transport.ErrEmptyRemoteRepository {
-			return nil, trace.TraceError(err)
-		}
-		return nil, nil
+	// remote branches
+	ctx, done := c.startOperation()
+	defer done()
+	refs, err := r.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, trace.TraceError(err)
 	}
-
-	// iterate refs
+	remoteBranches := map[string]bool{}
 	for _, ref := range refs {
-		// ref type
-		var refType string
-		if strings.HasPrefix(ref.Name().String(), "refs/heads") {
-			refType = GitRefTypeBranch
-		} else if strings.HasPrefix(ref.Name().String(), "refs/tags") {
-			refType = GitRefTypeTag
-		} else {
-			continue
+		if ref.Name().IsBranch() {
+			remoteBranches[ref.Name().Short()] = true
 		}
-
-		// add to branches
-		gitRefs = append(gitRefs, GitRef{
-			Type:     refType,
-			Name:     ref.Name().Short(),
-			FullName: ref.Name().String(),
-			Hash:     ref.Hash().String(),
-		})
 	}
 
-	// logs without tags
-	logs, err := c.GetLogs()
+	// stale remote-tracking branches
+	iter, err := c.r.References()
 	if err != nil {
-		return nil, err
+		return nil, trace.TraceError(err)
 	}
-
-	// logs map
-	logsMap := map[string]GitLog{}
-	for _, l := range logs {
-		logsMap[l.Hash] = l
+	prefix := plumbing.NewRemoteReferenceName(remoteName, "").String()
+	var stale []plumbing.ReferenceName
+	if err := iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		branch := strings.TrimPrefix(name, prefix)
+		if branch == plumbing.HEAD.String() || remoteBranches[branch] {
+			return nil
+		}
+		stale = append(stale, ref.Name())
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
 	}
 
-	// iterate git refs
-	for i, gitRef := range gitRefs {
-		l, ok := logsMap[gitRef.Hash]
-		if !ok {
-			continue
+	// prune
+	for _, name := range stale {
+		if err := c.r.Storer.RemoveReference(name); err != nil {
+			return nil, trace.TraceError(err)
 		}
-		gitRefs[i].Timestamp = l.Timestamp
+		pruned = append(pruned, name.Short())
 	}
+	c.logEvent(GitLogLevelInfo, "remote pruned", "remote", remoteName, "count", len(pruned))
 
-	// sort git refs
-	sort.Slice(gitRefs, func(i, j int) bool {
-		return gitRefs[i].Timestamp.Unix() > gitRefs[j].Timestamp.Unix()
-	})
+	return pruned, nil
+}
 
-	return gitRefs, nil
+// GetFileContentAtRef returns the raw content of the file at filePath in ref. Use
+// IsBinaryContent to tell whether it can be rendered as text.
+func (c *GitClient) GetFileContentAtRef(filePath, ref string) (data []byte, err error) {
+	// commit
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getCommitFileContent(commit, filePath)
 }
 
-func (c *GitClient) GetTags() (tags []GitRef, err error) {
-	iter, err := c.r.Tags()
+// GetThreeWayContent returns the versions of the file at filePath in the merge base of
+// the refs ours and theirs and in each of them, for a three-way merge before (or
+// without) merging. A version is nil if the file is absent there, or if the refs
+// share no history for base.
+func (c *GitClient) GetThreeWayContent(filePath, ours, theirs string) (base, oursContent, theirsContent []byte, err error) {
+	// commits
+	oursCommit, err := c.getCommitByRef(ours)
 	if err != nil {
-		return nil, trace.TraceError(err)
+		return nil, nil, nil, err
+	}
+	theirsCommit, err := c.getCommitByRef(theirs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	bases, err := oursCommit.MergeBase(theirsCommit)
+	if err != nil {
+		return nil, nil, nil, trace.TraceError(err)
 	}
 
-	_ = iter.ForEach(func(r *plumbing.Reference) error {
-		tags = append(tags, GitRef{
-			Type: GitRefTypeTag,
-			Name: r.Name().Short(),
-			Hash: r.Hash().String(),
-		})
-		return nil
-	})
+	// versions
+	var found bool
+	for _, item := range []struct {
+		commit *object.Commit
+		data   *[]byte
+	}{
+		{oursCommit, &oursContent},
+		{theirsCommit, &theirsContent},
+	} {
+		*item.data, err = c.getCommitFileContent(item.commit, filePath)
+		if err != nil && !errors.Is(err, ErrFileNotFoundInTree) {
+			return nil, nil, nil, err
+		}
+		found = found || err == nil
+	}
+	if len(bases) > 0 {
+		base, err = c.getCommitFileContent(bases[0], filePath)
+		if err != nil && !errors.Is(err, ErrFileNotFoundInTree) {
+			return nil, nil, nil, err
+		}
+		found = found || err == nil
+	}
+	if !found {
+		return nil, nil, nil, trace.TraceError(ErrFileNotFoundInTree)
+	}
 
-	return tags, nil
+	return base, oursContent, theirsContent, nil
 }
 
-func (c *GitClient) GetStatus() (statusList []GitFileStatus, err error) {
+// HashFile returns the git blob hash of the worktree file at filePath, which equals
+// its tree entry hash when committed unchanged.
+func (c *GitClient) HashFile(filePath string) (hash string, err error) {
 	// worktree
 	wt, err := c.r.Worktree()
 	if err != nil {
-		return nil, trace.TraceError(err)
+		return "", trace.TraceError(err)
 	}
 
-	// status
-	status, err := wt.Status()
+	// content
+	data, err := util.ReadFile(wt.Filesystem, filePath)
 	if err != nil {
-		log.Warnf("failed to get worktree status: %v", err)
+		return "", trace.TraceError(err)
 	}
 
-	// file status list
-	var list []GitFileStatus
-	for filePath, fileStatus := range status {
-		// file name
-		fileName := path.Base(filePath)
+	return c.HashBytes(data), nil
+}
 
-		// file status
-		s := GitFileStatus{
-			Path:     filePath,
-			Name:     fileName,
-			IsDir:    false,
-			Staging:  c.getStatusString(fileStatus.Staging),
-			Worktree: c.getStatusString(fileStatus.Worktree),
-			Extra:    fileStatus.Extra,
+// HashBytes returns the git blob hash of data, i.e. the sha1 of "blob <len>\x00<data>".
+func (c *GitClient) HashBytes(data []byte) (hash string) {
+	return plumbing.ComputeHash(plumbing.BlobObject, data).String()
+}
+
+// CatObject returns the type and content of the object hash like git cat-file -p:
+// trees are listed one entry per line, other objects are returned as stored.
+func (c *GitClient) CatObject(hash string) (objType string, content []byte, err error) {
+	obj, err := c.r.Storer.EncodedObject(plumbing.AnyObject, plumbing.NewHash(hash))
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return "", nil, trace.TraceError(ErrObjectNotFound)
 		}
+		return "", nil, trace.TraceError(err)
+	}
 
-		// add to list
-		list = append(list, s)
+	// tree listing
+	if obj.Type() == plumbing.TreeObject {
+		tree, err := object.DecodeTree(c.r.Storer, obj)
+		if err != nil {
+			return "", nil, trace.TraceError(err)
+		}
+		buf := &bytes.Buffer{}
+		for _, entry := range tree.Entries {
+			entryType := plumbing.BlobObject
+			switch entry.Mode {
+			case filemode.Dir:
+				entryType = plumbing.TreeObject
+			case filemode.Submodule:
+				entryType = plumbing.CommitObject
+			}
+			_, _ = fmt.Fprintf(buf, "%06o %s %s\t%s\n", uint32(entry.Mode), entryType, entry.Hash, entry.Name)
+		}
+		return obj.Type().String(), buf.Bytes(), nil
 	}
 
-	// sort list ascending
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].Path < list[j].Path
-	})
+	// raw content
+	reader, err := obj.Reader()
+	if err != nil {
+		return "", nil, trace.TraceError(err)
+	}
+	defer reader.Close()
+	content, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return "", nil, trace.TraceError(err)
+	}
 
-	return list, nil
+	return obj.Type().String(), content, nil
 }
 
-func (c *GitClient) Add(filePath string) (err error) {
+func (c *GitClient) RestoreFile(filePath, fromRef string) (err error) {
+	// content at ref
+	data, err := c.GetFileContentAtRef(filePath, fromRef)
+	if err != nil {
+		return err
+	}
+
 	// worktree
 	wt, err := c.r.Worktree()
 	if err != nil {
 		return trace.TraceError(err)
 	}
 
+	// create parent directory if not exists
+	if dirPath := path.Dir(filePath); dirPath != "." {
+		if err := wt.Filesystem.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// write
+	if err := util.WriteFile(wt.Filesystem, filePath, data, c.defaultFileMode); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// stage
 	if _, err := wt.Add(filePath); err != nil {
 		return trace.TraceError(err)
 	}
@@ -671,312 +1311,4361 @@ func (c *GitClient) Add(filePath string) (err error) {
 	return nil
 }
 
-func (c *GitClient) GetRemote(name string) (r *git.Remote, err error) {
-	return c.r.Remote(name)
-}
+// CheckoutPaths restores the files matching the glob patterns to their content at the
+// branch or hash of the options, HEAD by default, and stages them. Patterns are matched
+// against the files of that ref, so deleted files are restored as well, and a pattern
+// matching a directory covers the files inside it. Files absent in the ref are kept.
+func (c *GitClient) CheckoutPaths(patterns []string, opts ...GitCheckoutOption) (err error) {
+	// apply options
+	o := &GitCheckoutOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
-func (c *GitClient) CreateRemote(cfg *config.RemoteConfig) (r *git.Remote, err error) {
+	// source ref
+	ref := plumbing.HEAD.String()
+	if !o.Hash.IsZero() {
+		ref = o.Hash.String()
+	} else if o.Branch != "" {
+		ref = o.Branch.String()
+	}
+
+	// files of ref
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return err
+	}
+	files, err := c.getCommitFiles(commit)
+	if err != nil {
+		return err
+	}
+
+	// expand patterns
+	var matched []string
+	for filePath := range files {
+		for _, pattern := range patterns {
+			ok, err := matchPathPattern(pattern, filePath)
+			if err != nil {
+				return trace.TraceError(err)
+			}
+			if ok {
+				matched = append(matched, filePath)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return trace.TraceError(ErrNoMatchedPaths)
+	}
+	sort.Strings(matched)
+
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// restore
+	for _, filePath := range matched {
+		if err := c.checkoutFile(wt, filePath, files[filePath]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MaterializeRef writes the files of ref to destDir, or to the worktree of the client
+// if destDir is empty or its path, without moving HEAD or touching the index. In the
+// worktree, tracked files absent in ref are removed while untracked files are kept, so
+// the worktree is left dirty against HEAD until Reset.
+func (c *GitClient) MaterializeRef(ref, destDir string) (err error) {
+	// commit files
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return err
+	}
+	files, err := c.getCommitFiles(commit)
+	if err != nil {
+		return err
+	}
+
+	// destination
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	fs := wt.Filesystem
+	isWorktree := destDir == ""
+	if !isWorktree && !c.isMem {
+		// compare real paths, so relative or symlinked paths to the worktree match
+		destPath, err := getRealPath(destDir)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		worktreePath, err := getRealPath(c.path)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		isWorktree = destPath == worktreePath
+	}
+	if !isWorktree {
+		if err := os.MkdirAll(destDir, c.repoDirMode); err != nil {
+			return trace.TraceError(err)
+		}
+		fs = osfs.New(destDir)
+	}
+
+	// remove tracked files absent in ref
+	if isWorktree {
+		idx, err := c.r.Storer.Index()
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		for _, e := range idx.Entries {
+			if _, ok := files[e.Name]; ok {
+				continue
+			}
+			if err := fs.Remove(e.Name); err != nil && !os.IsNotExist(err) {
+				return trace.TraceError(err)
+			}
+		}
+	}
+
+	// write files
+	for filePath, f := range files {
+		if err := c.writeTreeFile(fs, filePath, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *GitClient) VerifyCommit(ref, armoredKeyRing string) (err error) {
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return err
+	}
+	if commit.PGPSignature == "" {
+		return trace.TraceError(ErrCommitNotSigned)
+	}
+	if _, err := commit.Verify(armoredKeyRing); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// ResolveTagCommit peels the tag tagName down to the commit it points to, following
+// nested annotated tags. Lightweight tags resolve to their commit directly.
+func (c *GitClient) ResolveTagCommit(tagName string) (l GitLog, err error) {
+	ref, err := c.r.Tag(tagName)
+	if err != nil {
+		return l, trace.TraceError(err)
+	}
+	commit, err := c.peelTag(ref.Hash())
+	if err != nil {
+		return l, err
+	}
+	return c.getGitLog(commit), nil
+}
+
+// VerifyTag verifies the signature of the annotated tag name against keyring and
+// returns the signer. Lightweight tags have no signature to verify.
+func (c *GitClient) VerifyTag(name string, keyring openpgp.KeyRing) (signer *openpgp.Entity, err error) {
+	// tag ref
+	ref, err := c.r.Tag(name)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// annotated tag object
+	tag, err := c.r.TagObject(ref.Hash())
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return nil, trace.TraceError(ErrTagNotAnnotated)
+		}
+		return nil, trace.TraceError(err)
+	}
+	if tag.PGPSignature == "" {
+		return nil, trace.TraceError(ErrTagNotSigned)
+	}
+
+	// signed payload (tag encoded without its signature)
+	encoded := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(encoded); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer reader.Close()
+
+	// verify
+	signer, err = openpgp.CheckArmoredDetachedSignature(keyring, reader, strings.NewReader(tag.PGPSignature), nil)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return signer, nil
+}
+
+func (c *GitClient) UpdateSubmodules(opts ...GitSubmoduleUpdateOption) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// auth
+	auth, err := c.getGitAuth(c.remoteUrl)
+	if err != nil {
+		return err
+	}
+
+	// apply options
+	o := &git.SubmoduleUpdateOptions{
+		Init: true,
+		Auth: auth,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// submodules
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// update
+	c.logEvent(GitLogLevelInfo, "update submodules started", "count", len(submodules))
+	err = submodules.Update(o)
+	c.logResult("update submodules finished", err)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) GetDiff(fromHash, toHash string) (files []GitDiffFile, err error) {
+	// trees (an empty hash diffs against an empty tree)
+	fromTree, err := c.getTreeByRef(fromHash)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := c.getTreeByRef(toHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// changes
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// files
+	for _, change := range changes {
+		f, err := getDiffFile(change)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func (c *GitClient) GetDiffHunks(fromHash, toHash, filePath string) (hunks []GitDiffHunk, err error) {
+	// trees (an empty hash diffs against an empty tree)
+	fromTree, err := c.getTreeByRef(fromHash)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := c.getTreeByRef(toHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// changes
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// hunks of the file (none if binary)
+	for _, change := range changes {
+		if change.From.Name != filePath && change.To.Name != filePath {
+			continue
+		}
+		f, err := getDiffFile(change)
+		if err != nil {
+			return nil, err
+		}
+		hunks = append(hunks, f.Hunks...)
+	}
+
+	return hunks, nil
+}
+
+// GetUnstagedDiff returns the changes of the tracked files under filePath between
+// the index and the worktree, i.e. what "git diff" shows. An empty filePath covers
+// the whole repo; untracked files are not included.
+func (c *GitClient) GetUnstagedDiff(filePath string) (files []GitDiffFile, err error) {
+	// index tree
+	indexTree, err := c.getIndexTree(filePath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// worktree tree (tracked files only)
+	worktreeTree, err := c.getIndexTree(filePath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getTreesDiff(indexTree, worktreeTree, filePath)
+}
+
+// GetStagedDiff returns the changes of the files under filePath between HEAD and the
+// index, i.e. what "git diff --cached" shows. An empty filePath covers the whole repo.
+func (c *GitClient) GetStagedDiff(filePath string) (files []GitDiffFile, err error) {
+	// HEAD tree (empty if there are no commits yet)
+	var headTree *object.Tree
+	headRef, err := c.r.Head()
+	if err == nil {
+		headTree, err = c.getTreeByRef(headRef.Hash().String())
+		if err != nil {
+			return nil, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, trace.TraceError(err)
+	}
+
+	// index tree
+	indexTree, err := c.getIndexTree(filePath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getTreesDiff(headTree, indexTree, filePath)
+}
+
+// WithRef checks out ref (detached), runs fn and restores the original HEAD afterwards,
+// even if fn returns an error or panics. It refuses to run over tracked local changes
+// unless the checkout options force it.
+func (c *GitClient) WithRef(ref string, fn func() error, opts ...GitCheckoutOption) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// apply options
+	o := &GitCheckoutOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// refuse to run over a dirty worktree
+	if !o.Force {
+		if err := c.validateWorktreeClean(wt); err != nil {
+			return err
+		}
+	}
+
+	// current HEAD
+	headRef, err := c.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// checkout ref
+	hash, err := c.r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: o.Force}); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// restore HEAD
+	defer func() {
+		restoreOpts := &git.CheckoutOptions{Force: true}
+		if headRef.Type() == plumbing.SymbolicReference {
+			restoreOpts.Branch = headRef.Target()
+		} else {
+			restoreOpts.Hash = headRef.Hash()
+		}
+		if restoreErr := wt.Checkout(restoreOpts); restoreErr != nil && err == nil {
+			err = trace.TraceError(restoreErr)
+		}
+	}()
+
+	return fn()
+}
+
+func (c *GitClient) GetConfig(section, key string) (value string, err error) {
+	return c.GetConfigScoped(config.LocalScope, section, key)
+}
+
+// GetConfigScoped reads key from the config of the given scope only, e.g. the
+// global user.email. A section may include a subsection, e.g. "remote.origin".
+func (c *GitClient) GetConfigScoped(scope config.Scope, section, key string) (value string, err error) {
+	// config of the scope
+	var cfg *config.Config
+	if scope == config.LocalScope {
+		cfg, err = c.r.Config()
+	} else {
+		cfg, err = config.LoadConfig(scope)
+	}
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	// section and subsection
+	var subsection string
+	if i := strings.Index(section, "."); i >= 0 {
+		section, subsection = section[:i], section[i+1:]
+	}
+	if !cfg.Raw.HasSection(section) {
+		return "", trace.TraceError(ErrConfigNotFound)
+	}
+	options := cfg.Raw.Section(section).Options
+	if subsection != "" {
+		if !cfg.Raw.Section(section).HasSubsection(subsection) {
+			return "", trace.TraceError(ErrConfigNotFound)
+		}
+		options = cfg.Raw.Section(section).Subsection(subsection).Options
+	}
+
+	// value
+	if !options.Has(key) {
+		return "", trace.TraceError(ErrConfigNotFound)
+	}
+	return options.Get(key), nil
+}
+
+// ListRecoverablePoints returns dangling commits, i.e. commits not reachable from any
+// ref nor from other unreachable commits, such as commits lost by resets or amends.
+func (c *GitClient) ListRecoverablePoints() (points []GitRecoveryPoint, err error) {
+	// commits reachable from refs
+	reachable, err := c.getReachableCommits()
+	if err != nil {
+		return nil, err
+	}
+
+	// unreachable commits
+	var unreachable []*object.Commit
+	iter, err := c.r.CommitObjects()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(commit *object.Commit) error {
+		if !reachable[commit.Hash] {
+			unreachable = append(unreachable, commit)
+		}
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// exclude parents of other unreachable commits
+	parents := map[plumbing.Hash]bool{}
+	for _, commit := range unreachable {
+		for _, h := range commit.ParentHashes {
+			parents[h] = true
+		}
+	}
+	for _, commit := range unreachable {
+		if parents[commit.Hash] {
+			continue
+		}
+		points = append(points, GitRecoveryPoint{
+			Hash:      commit.Hash.String(),
+			Msg:       commit.Message,
+			Timestamp: commit.Committer.When,
+		})
+	}
+
+	// latest first
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Timestamp.After(points[j].Timestamp)
+	})
+
+	return points, nil
+}
+
+// PreviewReset returns what Reset to hash with mode would discard without resetting:
+// commits that would become unreachable and files whose changes would be lost.
+func (c *GitClient) PreviewReset(hash string, mode git.ResetMode) (lostCommits []GitLog, lostFiles []string, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, nil, trace.TraceError(err)
+	}
+
+	// HEAD and target
+	headRef, err := c.r.Head()
+	if err != nil {
+		return nil, nil, trace.TraceError(err)
+	}
+	target, err := c.getCommitByRef(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// commits reachable from HEAD but not from target, nor from other refs
+	logs, err := c.getLogsBetween(target.Hash, headRef.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	reachable, err := c.getReachableCommits(plumbing.HEAD, headRef.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, l := range logs {
+		if !reachable[plumbing.NewHash(l.Hash)] {
+			lostCommits = append(lostCommits, l)
+		}
+	}
+
+	// files (untracked files are cleaned by Reset in any mode)
+	status, err := wt.Status()
+	if err != nil {
+		return nil, nil, trace.TraceError(err)
+	}
+	for filePath, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked || mode == git.HardReset {
+			lostFiles = append(lostFiles, filePath)
+		}
+	}
+	sort.Strings(lostFiles)
+
+	return lostCommits, lostFiles, nil
+}
+
+func (c *GitClient) SetUpstream(branch, remoteName string) (err error) {
+	// branch
+	if branch == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return err
+		}
+	}
+
+	// remote
+	if _, err := c.r.Remote(remoteName); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// branch config
+	cfg, err := c.r.Config()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	b, ok := cfg.Branches[branch]
+	if !ok {
+		b = &config.Branch{Name: branch}
+		cfg.Branches[branch] = b
+	}
+	b.Remote = remoteName
+	b.Merge = plumbing.NewBranchReferenceName(branch)
+	if err := c.r.SetConfig(cfg); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) GetUpstreamUrl(branch string) (remoteName, url string, err error) {
+	// branch
+	if branch == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// upstream remote
+	cfg, err := c.r.Config()
+	if err != nil {
+		return "", "", trace.TraceError(err)
+	}
+	b, ok := cfg.Branches[branch]
+	if !ok || b.Remote == "" {
+		return "", "", trace.TraceError(ErrNoUpstream)
+	}
+
+	// remote url
+	r, ok := cfg.Remotes[b.Remote]
+	if !ok || len(r.URLs) == 0 {
+		return "", "", trace.TraceError(git.ErrRemoteNotFound)
+	}
+
+	return b.Remote, r.URLs[0], nil
+}
+
+// ResolveSymbolicRef follows the symbolic reference name, e.g. HEAD, down to the
+// name of the terminal ref it points to, e.g. refs/heads/main, which may not exist
+// yet (unborn branch). A ref that is not symbolic is returned unchanged.
+func (c *GitClient) ResolveSymbolicRef(name string) (refName string, err error) {
+	refName = name
+	for i := 0; i < storer.MaxResolveRecursion; i++ {
+		ref, err := c.r.Storer.Reference(plumbing.ReferenceName(refName))
+		if err == plumbing.ErrReferenceNotFound && refName != name {
+			return refName, nil
+		}
+		if err != nil {
+			return "", trace.TraceError(err)
+		}
+		if ref.Type() != plumbing.SymbolicReference {
+			return refName, nil
+		}
+		refName = ref.Target().String()
+	}
+	return "", trace.TraceError(storer.ErrMaxResolveRecursion)
+}
+
+// ResolveRef resolves ref as a local branch, tag, remote branch, full ref name or
+// revision (e.g. a hash), in that order. Hash of the returned ref is the commit hash,
+// with annotated tags peeled.
+func (c *GitClient) ResolveRef(ref string) (gitRef *GitRef, err error) {
+	// refs
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+		plumbing.ReferenceName("refs/remotes/" + ref),
+		plumbing.ReferenceName(ref),
+	} {
+		r, err := c.r.Reference(name, true)
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		commit, err := c.getCommitByRef(r.Hash().String())
+		if err != nil {
+			return nil, err
+		}
+		return &GitRef{
+			Type:     c.getRefType(name),
+			Name:     name.Short(),
+			FullName: name.String(),
+			Hash:     commit.Hash.String(),
+		}, nil
+	}
+
+	// revision
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &GitRef{
+		Type:     GitRefTypeCommit,
+		Name:     ref,
+		FullName: ref,
+		Hash:     commit.Hash.String(),
+	}, nil
+}
+
+// CreateBundle writes refs and all objects reachable from them to a git bundle
+// (v2) at bundlePath. refs may be short branch or tag names, full ref names or
+// HEAD; all branches and tags plus HEAD are bundled if refs is empty.
+func (c *GitClient) CreateBundle(bundlePath string, refs []string) (err error) {
+	// refs
+	bundleRefs, err := c.getBundleRefs(refs)
+	if err != nil {
+		return err
+	}
+
+	// file
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	defer f.Close()
+
+	// bundle
+	if err := writeGitBundle(f, c.r.Storer, bundleRefs); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) CheckoutRef(ref string) (err error) {
+	gitRef, err := c.ResolveRef(ref)
+	if err != nil {
+		return err
+	}
+
+	// attach HEAD to branches, detach for anything else
+	if gitRef.Type == GitRefTypeBranch {
+		return c.CheckoutBranch(gitRef.Name)
+	}
+	return c.CheckoutHash(gitRef.Hash)
+}
+
+// GetRepoState reports the operation in progress, from the markers recorded in the
+// git directory. Conflicted takes precedence if the index has unmerged entries.
+func (c *GitClient) GetRepoState() (state GitRepoState, err error) {
+	// conflicts
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return GitRepoStateConflicted, nil
+		}
+	}
+
+	// rebase
+	for _, name := range []string{GitRebaseMerge, GitRebaseApply} {
+		ok, err := c.isGitFileExists(name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return GitRepoStateRebasing, nil
+		}
+	}
+
+	// merge, cherry-pick and revert
+	for _, item := range []struct {
+		name  plumbing.ReferenceName
+		state GitRepoState
+	}{
+		{GitMergeHead, GitRepoStateMerging},
+		{GitCherryPickHead, GitRepoStateCherryPicking},
+		{GitRevertHead, GitRepoStateReverting},
+	} {
+		_, err := c.r.Reference(item.name, false)
+		if err == nil {
+			return item.state, nil
+		}
+		if err != plumbing.ErrReferenceNotFound {
+			return "", trace.TraceError(err)
+		}
+	}
+
+	return GitRepoStateClean, nil
+}
+
+// CommitTree stores a commit of the tree treeHash with the given parents and returns
+// its hash, without touching the worktree or any ref. It works in bare repos.
+func (c *GitClient) CommitTree(treeHash string, parents []string, msg string, author *object.Signature) (hash string, err error) {
+	if author == nil {
+		return "", trace.TraceError(ErrInvalidOptions)
+	}
+
+	// tree
+	tree, err := c.r.TreeObject(plumbing.NewHash(treeHash))
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	// parents
+	parentHashes := make([]plumbing.Hash, len(parents))
+	for i, parent := range parents {
+		commit, err := c.r.CommitObject(plumbing.NewHash(parent))
+		if err != nil {
+			return "", trace.TraceError(err)
+		}
+		parentHashes[i] = commit.Hash
+	}
+
+	// commit
+	commit := &object.Commit{
+		Author:       *author,
+		Committer:    *author,
+		Message:      msg,
+		TreeHash:     tree.Hash,
+		ParentHashes: parentHashes,
+	}
+	obj := c.r.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return "", trace.TraceError(err)
+	}
+	h, err := c.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	return h.String(), nil
+}
+
+// RewordCommit replaces the message of the commit hash. This rewrites history: the
+// commit and all its descendants get new hashes, and the local branches (and a
+// detached HEAD) containing it are moved to the rewritten commits. Commits reachable
+// from a remote-tracking branch are refused with ErrCommitPushed unless forced.
+func (c *GitClient) RewordCommit(hash, newMsg string, opts ...GitRewordOption) (err error) {
+	// validate
+	if strings.TrimSpace(newMsg) == "" {
+		return trace.TraceError(ErrEmptyCommitMessage)
+	}
+
+	// apply options
+	o := &GitRewordOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// target commit
+	target, err := c.r.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// refs to rewrite (branches and detached HEAD)
+	var refs []*plumbing.Reference
+	var pushed bool
+	iter, err := c.r.References()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch {
+		case ref.Name().IsBranch(), ref.Name() == plumbing.HEAD:
+			refs = append(refs, ref)
+		case ref.Name().IsRemote() && !o.Force && !pushed:
+			ok, err := c.isAncestor(target.Hash, ref.Hash())
+			if err != nil && err != plumbing.ErrObjectNotFound {
+				return err
+			}
+			pushed = ok
+		}
+		return nil
+	}); err != nil {
+		return trace.TraceError(err)
+	}
+	if pushed {
+		return trace.TraceError(ErrCommitPushed)
+	}
+
+	// rewrite
+	rewritten := map[plumbing.Hash]plumbing.Hash{}
+	for _, ref := range refs {
+		newHash, err := c.rewordCommit(ref.Hash(), target.Hash, newMsg, rewritten)
+		if err != nil {
+			return err
+		}
+		if newHash == ref.Hash() {
+			continue
+		}
+		if err := c.r.Storer.SetReference(plumbing.NewHashReference(ref.Name(), newHash)); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	c.logEvent(GitLogLevelInfo, "commit reworded", "hash", hash, "new_hash", rewritten[target.Hash].String())
+
+	return nil
+}
+
+// Squash replaces the commits after fromHash up to HEAD with a single commit with msg,
+// the tree of HEAD and the author of the earliest squashed commit, and moves the
+// current branch to it. The range must be linear (no merge commits).
+func (c *GitClient) Squash(fromHash string, msg string) (err error) {
+	// validate
+	if strings.TrimSpace(msg) == "" {
+		return trace.TraceError(ErrEmptyCommitMessage)
+	}
+
+	// current branch
+	headRef, err := c.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if headRef.Type() != plumbing.SymbolicReference {
+		return trace.TraceError(ErrInvalidHeadRef)
+	}
+	branchRef, err := c.r.Reference(headRef.Target(), true)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// commits to squash, newest first
+	fromCommit, err := c.getCommitByRef(fromHash)
+	if err != nil {
+		return err
+	}
+	headCommit, err := c.r.CommitObject(branchRef.Hash())
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	var commits []*object.Commit
+	for commit := headCommit; commit.Hash != fromCommit.Hash; {
+		if commit.NumParents() > 1 {
+			return trace.TraceError(ErrSquashMergeCommit)
+		}
+		if commit.NumParents() == 0 {
+			return trace.TraceError(ErrNotAncestorOfHead)
+		}
+		commits = append(commits, commit)
+		commit, err = commit.Parent(0)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	// squashed commit
+	committer := headCommit.Committer
+	committer.When = time.Now()
+	squashed := &object.Commit{
+		Author:       commits[len(commits)-1].Author,
+		Committer:    committer,
+		Message:      msg,
+		TreeHash:     headCommit.TreeHash,
+		ParentHashes: []plumbing.Hash{fromCommit.Hash},
+	}
+	obj := c.r.Storer.NewEncodedObject()
+	if err := squashed.Encode(obj); err != nil {
+		return trace.TraceError(err)
+	}
+	hash, err := c.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// update branch (the tree is unchanged, so the index and worktree stay as they are)
+	if err := c.r.Storer.SetReference(plumbing.NewHashReference(branchRef.Name(), hash)); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+// ImportCommits creates the given commits in order on the current branch and moves
+// the branch to the last one, checking it out. The worktree must be clean.
+func (c *GitClient) ImportCommits(commits []GitImportCommit) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := c.validateWorktreeClean(wt); err != nil {
+		return err
+	}
+
+	// target branch
+	headRef, err := c.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if headRef.Type() != plumbing.SymbolicReference {
+		return trace.TraceError(ErrInvalidHeadRef)
+	}
+	branchRefName := headRef.Target()
+
+	// branch tip (zero if unborn)
+	var parentHash plumbing.Hash
+	branchRef, err := c.r.Reference(branchRefName, true)
+	if err == nil {
+		parentHash = branchRef.Hash()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return trace.TraceError(err)
+	}
+
+	// commits
+	for _, ic := range commits {
+		if ic.Parent != "" {
+			parentCommit, err := c.getCommitByRef(ic.Parent)
+			if err != nil {
+				return err
+			}
+			parentHash = parentCommit.Hash
+		}
+		parentHash, err = c.importCommit(ic, parentHash)
+		if err != nil {
+			return err
+		}
+	}
+	if parentHash.IsZero() {
+		return nil
+	}
+
+	// update branch and worktree
+	if err := c.r.Storer.SetReference(plumbing.NewHashReference(branchRefName, parentHash)); err != nil {
+		return trace.TraceError(err)
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: parentHash, Mode: git.HardReset}); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+// GetObjectCacheStats returns the hits and misses of the object cache enabled
+// with WithObjectCache, misses being the objects read from the storage.
+func (c *GitClient) GetObjectCacheStats() (stats GitObjectCacheStats) {
+	if s, ok := c.r.Storer.(*gitObjectCacheStorage); ok {
+		return s.getStats()
+	}
+	return stats
+}
+
+// Cancel cancels the network operations (clone, pull, fetch, push and remote
+// listing) currently in flight on the client, which then return context.Canceled.
+// Operations started afterwards are not affected.
+func (c *GitClient) Cancel() {
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
+	for _, cancel := range c.opCancels {
+		cancel()
+	}
+}
+
+// RelPath returns the slash separated path of absPath relative to the repo root,
+// as expected by the methods taking file paths, or ErrPathOutsideRepo if absPath is
+// not under the repo. Both the client path and its resolved symlink are accepted.
+func (c *GitClient) RelPath(absPath string) (relPath string, err error) {
+	absPath, err = filepath.Abs(absPath)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	for _, root := range []string{c.path, c.realPath} {
+		if root == "" {
+			continue
+		}
+		root, err = filepath.Abs(root)
+		if err != nil {
+			return "", trace.TraceError(err)
+		}
+		rel, err := filepath.Rel(root, absPath)
+		if err != nil {
+			continue
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	return "", trace.TraceError(ErrPathOutsideRepo)
+}
+
+func (c *GitClient) GetRepository() (r *git.Repository) {
+	return c.r
+}
+
+func (c *GitClient) GetPath() (path string) {
+	return c.path
+}
+
+func (c *GitClient) SetPath(path string) {
+	c.path = path
+}
+
+func (c *GitClient) GetRemoteUrl() (path string) {
+	return c.remoteUrl
+}
+
+func (c *GitClient) SetRemoteUrl(url string) {
+	c.remoteUrl = url
+}
+
+func (c *GitClient) GetIsMem() (isMem bool) {
+	return c.isMem
+}
+
+func (c *GitClient) SetIsMem(isMem bool) {
+	c.isMem = isMem
+}
+
+func (c *GitClient) GetAuthType() (authType GitAuthType) {
+	return c.authType
+}
+
+func (c *GitClient) SetAuthType(authType GitAuthType) {
+	c.authType = authType
+}
+
+func (c *GitClient) GetUsername() (username string) {
+	return c.username
+}
+
+func (c *GitClient) SetUsername(username string) {
+	c.username = username
+}
+
+func (c *GitClient) GetPassword() (password string) {
+	return c.password
+}
+
+func (c *GitClient) SetPassword(password string) {
+	c.password = password
+}
+
+func (c *GitClient) GetPrivateKey() (key string) {
+	return c.privateKey
+}
+
+func (c *GitClient) SetPrivateKey(key string) {
+	c.privateKey = key
+}
+
+func (c *GitClient) GetPrivateKeyPath() (path string) {
+	return c.privateKeyPath
+}
+
+func (c *GitClient) SetPrivateKeyPath(path string) {
+	c.privateKeyPath = path
+}
+
+func (c *GitClient) GetCurrentBranch() (branch string, err error) {
+	// ref pointed to by HEAD, which may not exist yet on an unborn branch
+	refName, err := c.ResolveSymbolicRef(plumbing.HEAD.String())
+	if err != nil {
+		return "", err
+	}
+	if !plumbing.ReferenceName(refName).IsBranch() {
+		return "", trace.TraceError(ErrUnableToGetCurrentBranch)
+	}
+
+	return plumbing.ReferenceName(refName).Short(), nil
+}
+
+func (c *GitClient) GetHeadHash() (hash string, err error) {
+	headRef, err := c.r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// unborn branch
+		return "", trace.TraceError(ErrNoCommits)
+	}
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	return headRef.Hash().String(), nil
+}
+
+func (c *GitClient) GetCurrentBranchRef() (ref *GitRef, err error) {
+	currentBranch, err := c.GetCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	branches, err := c.GetBranches()
+	if err != nil {
+		return nil, err
+	}
+	for _, branch := range branches {
+		if branch.Name == currentBranch {
+			return &branch, nil
+		}
+	}
+	return nil, trace.TraceError(ErrUnableToGetCurrentBranch)
+}
+
+func (c *GitClient) GetBranches() (branches []GitRef, err error) {
+	iter, err := c.r.Branches()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	_ = iter.ForEach(func(r *plumbing.Reference) error {
+		branches = append(branches, GitRef{
+			Type: GitRefTypeBranch,
+			Name: r.Name().Short(),
+			Hash: r.Hash().String(),
+		})
+		return nil
+	})
+
+	return branches, nil
+}
+
+// IsAncestor reports whether the commit of ref ancestor is reachable from the
+// commit of ref descendant. A commit is its own ancestor.
+func (c *GitClient) IsAncestor(ancestor, descendant string) (ok bool, err error) {
+	ancestorCommit, err := c.getCommitByRef(ancestor)
+	if err != nil {
+		return false, err
+	}
+	descendantCommit, err := c.getCommitByRef(descendant)
+	if err != nil {
+		return false, err
+	}
+	ok, err = c.isAncestor(ancestorCommit.Hash, descendantCommit.Hash)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return ok, nil
+}
+
+// GetMergedBranches splits the local branches other than into by whether their tip
+// is merged into branch into (the current branch if empty).
+func (c *GitClient) GetMergedBranches(into string) (merged []string, unmerged []string, err error) {
+	// target branch
+	if into == "" {
+		into, err = c.GetCurrentBranch()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	intoRef, err := c.r.Reference(plumbing.NewBranchReferenceName(into), true)
+	if err != nil {
+		return nil, nil, trace.TraceError(err)
+	}
+
+	// branches
+	branches, err := c.GetBranches()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, b := range branches {
+		if b.Name == into {
+			continue
+		}
+		ok, err := c.isAncestor(plumbing.NewHash(b.Hash), intoRef.Hash())
+		if err != nil {
+			return nil, nil, trace.TraceError(err)
+		}
+		if ok {
+			merged = append(merged, b.Name)
+		} else {
+			unmerged = append(unmerged, b.Name)
+		}
+	}
+	sort.Strings(merged)
+	sort.Strings(unmerged)
+
+	return merged, unmerged, nil
+}
+
+func (c *GitClient) GetRemoteRefs(remoteName string) (gitRefs []GitRef, err error) {
+	// remote
+	r, err := c.r.Remote(remoteName)
+	if err != nil {
+		if err == git.ErrRemoteNotFound {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	// auth
+	auth, err := c.getGitAuth(c.getRemoteUrl(remoteName))
+	if err != nil {
+		return nil, err
+	}
+
+	// refs
+	ctx, done := c.startOperation()
+	defer done()
+	c.logEvent(GitLogLevelInfo, "list remote refs started", "remote", remoteName)
+	refs, err := r.ListContext(ctx, &git.ListOptions{Auth: auth})
+	c.logResult("list remote refs finished", err)
+	if err != nil {
+		if err != transport.ErrEmptyRemoteRepository {
+			return nil, trace.TraceError(err)
+		}
+		return nil, nil
+	}
+
+	// iterate refs
+	for _, ref := range refs {
+		// ref type
+		var refType string
+		if strings.HasPrefix(ref.Name().String(), "refs/heads") {
+			refType = GitRefTypeBranch
+		} else if strings.HasPrefix(ref.Name().String(), "refs/tags") {
+			refType = GitRefTypeTag
+		} else {
+			continue
+		}
+
+		// add to branches
+		gitRefs = append(gitRefs, GitRef{
+			Type:     refType,
+			Name:     ref.Name().Short(),
+			FullName: ref.Name().String(),
+			Hash:     ref.Hash().String(),
+		})
+	}
+
+	// logs without tags
+	logs, err := c.GetLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	// logs map
+	logsMap := map[string]GitLog{}
+	for _, l := range logs {
+		logsMap[l.Hash] = l
+	}
+
+	// iterate git refs
+	for i, gitRef := range gitRefs {
+		l, ok := logsMap[gitRef.Hash]
+		if !ok {
+			continue
+		}
+		gitRefs[i].Timestamp = l.Timestamp
+	}
+
+	// sort git refs
+	sort.Slice(gitRefs, func(i, j int) bool {
+		return gitRefs[i].Timestamp.Unix() > gitRefs[j].Timestamp.Unix()
+	})
+
+	return gitRefs, nil
+}
+
+func (c *GitClient) GetTags() (tags []GitRef, err error) {
+	iter, err := c.r.Tags()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	_ = iter.ForEach(func(r *plumbing.Reference) error {
+		tags = append(tags, GitRef{
+			Type: GitRefTypeTag,
+			Name: r.Name().Short(),
+			Hash: r.Hash().String(),
+		})
+		return nil
+	})
+
+	return tags, nil
+}
+
+func (c *GitClient) BranchExists(name string) (ok bool, err error) {
+	return c.isRefExists(plumbing.NewBranchReferenceName(name))
+}
+
+func (c *GitClient) TagExists(name string) (ok bool, err error) {
+	return c.isRefExists(plumbing.NewTagReferenceName(name))
+}
+
+func (c *GitClient) RemoteExists(name string) (ok bool, err error) {
+	if _, err := c.r.Remote(name); err != nil {
+		if err == git.ErrRemoteNotFound {
+			return false, nil
+		}
+		return false, trace.TraceError(err)
+	}
+	return true, nil
+}
+
+// GetTagsForCommit returns the sorted names of the tags pointing at the commit hash
+// (or any ref accepted by ResolveRef), peeling annotated tags.
+func (c *GitClient) GetTagsForCommit(hash string) (tags []string, err error) {
+	// commit
+	gitRef, err := c.ResolveRef(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// matching tags
+	tags = []string{}
+	iter, err := c.r.Tags()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(r *plumbing.Reference) error {
+		commit, err := c.peelTag(r.Hash())
+		if err != nil {
+			if errors.Is(err, ErrTagNotCommit) {
+				return nil
+			}
+			return err
+		}
+		if commit.Hash.String() == gitRef.Hash {
+			tags = append(tags, r.Name().Short())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+
+	return tags, nil
+}
+
+// CreateTags creates the tags in order. By default it is best effort: the tags that
+// fail are skipped and reported in a GitTagErrors. With WithAtomicTagCreate, all the
+// targets are resolved and names checked first, and the tags already created are
+// removed if a later one fails, so that either all the tags or none are created.
+func (c *GitClient) CreateTags(tags []GitTagSpec, opts ...GitTagCreateOption) (err error) {
+	// apply options
+	o := &GitTagCreateOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// validate all tags first if atomic
+	if o.Atomic {
+		names := map[string]bool{}
+		for _, spec := range tags {
+			if names[spec.Name] {
+				return trace.TraceError(GitTagErrors{spec.Name: git.ErrTagExists})
+			}
+			names[spec.Name] = true
+			if ok, err := c.TagExists(spec.Name); err != nil {
+				return err
+			} else if ok {
+				return trace.TraceError(GitTagErrors{spec.Name: git.ErrTagExists})
+			}
+			if _, err := c.r.ResolveRevision(plumbing.Revision(spec.TargetRef)); err != nil {
+				return trace.TraceError(GitTagErrors{spec.Name: err})
+			}
+		}
+	}
+
+	// create
+	var created []plumbing.ReferenceName
+	tagErrs := GitTagErrors{}
+	for _, spec := range tags {
+		ref, err := c.createTag(spec)
+		if err == nil {
+			created = append(created, ref.Name())
+			continue
+		}
+		if !o.Atomic {
+			tagErrs[spec.Name] = err
+			continue
+		}
+
+		// roll back
+		for _, name := range created {
+			if err := c.r.Storer.RemoveReference(name); err != nil {
+				return trace.TraceError(err)
+			}
+		}
+		return trace.TraceError(GitTagErrors{spec.Name: err})
+	}
+	if len(tagErrs) > 0 {
+		return trace.TraceError(tagErrs)
+	}
+
+	return nil
+}
+
+// GetTagsDetailed returns the tags with their annotations, newest first by tagger
+// date (commit date for lightweight tags), paginated with WithSkipTagList and
+// WithLimitTagList.
+func (c *GitClient) GetTagsDetailed(opts ...GitTagListOption) (details []GitTagDetail, err error) {
+	// apply options
+	o := &GitTagListOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// tags
+	iter, err := c.r.Tags()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(r *plumbing.Reference) error {
+		d := GitTagDetail{Name: r.Name().Short()}
+		commit, err := c.peelTag(r.Hash())
+		if err != nil && !errors.Is(err, ErrTagNotCommit) {
+			return err
+		}
+		if commit != nil {
+			d.TargetCommitHash = commit.Hash.String()
+			d.TaggedAt = commit.Committer.When
+		}
+		tag, err := c.r.TagObject(r.Hash())
+		if err == nil {
+			d.IsAnnotated = true
+			d.TaggerName = tag.Tagger.Name
+			d.TaggerEmail = tag.Tagger.Email
+			d.TaggedAt = tag.Tagger.When
+			d.Message = tag.Message
+		} else if err != plumbing.ErrObjectNotFound {
+			return trace.TraceError(err)
+		}
+		details = append(details, d)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// sort
+	sort.SliceStable(details, func(i, j int) bool {
+		if !details[i].TaggedAt.Equal(details[j].TaggedAt) {
+			return details[i].TaggedAt.After(details[j].TaggedAt)
+		}
+		return details[i].Name < details[j].Name
+	})
+
+	// paginate
+	if o.Skip > 0 {
+		if o.Skip >= len(details) {
+			return nil, nil
+		}
+		details = details[o.Skip:]
+	}
+	if o.Limit > 0 && o.Limit < len(details) {
+		details = details[:o.Limit]
+	}
+
+	return details, nil
+}
+
+func (c *GitClient) GetAllRefs() (refs []GitRef, err error) {
+	iter, err := c.r.References()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	if err := iter.ForEach(func(r *plumbing.Reference) error {
+		ref := GitRef{
+			Type:     c.getRefType(r.Name()),
+			Name:     r.Name().Short(),
+			FullName: r.Name().String(),
+		}
+
+		// resolve symbolic reference (e.g. HEAD) to its target hash
+		if r.Type() == plumbing.SymbolicReference {
+			ref.IsSymbolic = true
+			ref.Target = r.Target().String()
+			resolvedRef, err := c.r.Reference(r.Name(), true)
+			if err == nil {
+				ref.Hash = resolvedRef.Hash().String()
+			}
+		} else {
+			ref.Hash = r.Hash().String()
+		}
+
+		refs = append(refs, ref)
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// sort by full name
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].FullName < refs[j].FullName
+	})
+
+	return refs, nil
+}
+
+func (c *GitClient) GetStatus() (statusList []GitFileStatus, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// status
+	status, err := wt.Status()
+	if err != nil {
+		log.Warnf("failed to get worktree status: %v", err)
+	}
+
+	// file status list
+	var list []GitFileStatus
+	for filePath, fileStatus := range status {
+		// file name
+		fileName := path.Base(filePath)
+
+		// file status
+		s := GitFileStatus{
+			Path:     filePath,
+			Name:     fileName,
+			IsDir:    false,
+			Staging:  c.getStatusString(fileStatus.Staging),
+			Worktree: c.getStatusString(fileStatus.Worktree),
+			Extra:    fileStatus.Extra,
+		}
+
+		// add to list
+		list = append(list, s)
+	}
+
+	// sort list ascending
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list, nil
+}
+
+// CheckOwnership verifies that the directories of fs repos are owned by the uid of
+// the current process, or the uid set by WithOwnerUid (git's "dubious ownership"
+// check), unless the repo path is trusted with WithTrustedPath. Ownership is not
+// checked on windows.
+func (c *GitClient) CheckOwnership() (err error) {
+	if c.isMem || c.isTrustedPath() {
+		return nil
+	}
+
+	// repo and git directories
+	uid := os.Geteuid()
+	if c.ownerUid != nil {
+		uid = *c.ownerUid
+	}
+	for _, p := range []string{c.path, path.Join(c.path, git.GitDirName)} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return trace.TraceError(err)
+		}
+		ownerUid, ok := getFileOwnerUid(fi)
+		if !ok {
+			continue
+		}
+		if ownerUid != uid {
+			c.logEvent(GitLogLevelError, "dubious ownership", "path", p, "owner", ownerUid, "uid", uid)
+			return trace.TraceError(ErrDubiousOwnership)
+		}
+	}
+
+	return nil
+}
+
+// GetAttributes returns the attributes in effect for filePath, relative to the repo
+// root, from the .gitattributes files of the worktree along its path. Attributes set
+// or unset are reported as GitAttributeValueSet or GitAttributeValueUnset, those with a
+// value as the value, e.g. attrs[GitAttributeExportIgnore] == GitAttributeValueSet for
+// a path "git archive" leaves out.
+func (c *GitClient) GetAttributes(filePath string) (attrs map[string]string, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// patterns of the directories along the path, in increasing priority
+	parts := strings.Split(strings.Trim(path.Clean("/"+filepath.ToSlash(filePath)), "/"), "/")
+	var stack []gitattributes.MatchAttribute
+	for i := 0; i < len(parts); i++ {
+		// capped so that appending the file name does not overwrite parts
+		dirAttrs, err := gitattributes.ReadAttributesFile(wt.Filesystem, parts[:i:i], GitAttributesFileName, i == 0)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		stack = append(stack, dirAttrs...)
+	}
+
+	// macros
+	macros := map[string]gitattributes.MatchAttribute{}
+	for _, ma := range stack {
+		if ma.Pattern == nil {
+			macros[ma.Name] = ma
+		}
+	}
+
+	// matched attributes, later patterns override earlier ones
+	attrs = map[string]string{}
+	for _, ma := range stack {
+		if ma.Pattern == nil || !ma.Pattern.Match(parts) {
+			continue
+		}
+		for _, attr := range ma.Attributes {
+			if macro, ok := macros[attr.Name()]; ok && attr.IsSet() {
+				for _, macroAttr := range macro.Attributes {
+					setAttributeValue(attrs, macroAttr)
+				}
+			}
+			setAttributeValue(attrs, attr)
+		}
+	}
+
+	return attrs, nil
+}
+
+// GetDescription returns the content of the description file of the repo, which git
+// web UIs show as its label. Mem repos have none and return ErrNotFsRepo.
+func (c *GitClient) GetDescription() (desc string, err error) {
+	if _, ok := c.fsStorage(); !ok {
+		return "", trace.TraceError(ErrNotFsRepo)
+	}
+	data, err := c.readGitFile(GitDescriptionFileName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetDescription writes desc to the description file of the repo (fs repos only).
+func (c *GitClient) SetDescription(desc string) (err error) {
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return trace.TraceError(ErrNotFsRepo)
+	}
+	if err := util.WriteFile(fsStorage.Filesystem(), GitDescriptionFileName, []byte(desc+"\n"), c.repoFileMode); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// ListHooks returns the executable scripts in the hooks directory of fs repos,
+// which git would run on operations. Mem repos have no hooks.
+func (c *GitClient) ListHooks() (hooks []GitHook, err error) {
+	hooks = []GitHook{}
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return hooks, nil
+	}
+
+	// hooks directory
+	dotGitFs := fsStorage.Filesystem()
+	files, err := dotGitFs.ReadDir(GitHooksDirName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hooks, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	// executable files
+	for _, f := range files {
+		if f.IsDir() || f.Mode()&0111 == 0 {
+			continue
+		}
+		hooks = append(hooks, GitHook{
+			Name:     f.Name(),
+			Path:     dotGitFs.Join(dotGitFs.Root(), GitHooksDirName, f.Name()),
+			IsSample: strings.HasSuffix(f.Name(), GitHookSampleSuffix),
+		})
+	}
+
+	return hooks, nil
+}
+
+// RemoveHooks disables the hooks of fs repos so that git cannot run them: scripts
+// in the hooks directory are renamed to .sample and made non-executable, and
+// core.hooksPath is unset. Mem repos have no hooks.
+func (c *GitClient) RemoveHooks() (err error) {
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return nil
+	}
+
+	// hooks
+	hooks, err := c.ListHooks()
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		samplePath := hook.Path
+		if !hook.IsSample {
+			samplePath += GitHookSampleSuffix
+			if err := os.Rename(hook.Path, samplePath); err != nil {
+				return trace.TraceError(err)
+			}
+		}
+		if err := os.Chmod(samplePath, c.repoFileMode&^0111); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// hooks path
+	cfg, err := fsStorage.Config()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if cfg.Raw.Section("core").HasOption("hooksPath") {
+		cfg.Raw.Section("core").RemoveOption("hooksPath")
+		if err := fsStorage.SetConfig(cfg); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	c.logEvent(GitLogLevelInfo, "hooks removed", "count", len(hooks))
+
+	return nil
+}
+
+// GetWorktreeChanges returns the uncommitted changes (staged or not) with the
+// modification time of the files in the worktree, zero for deleted files.
+func (c *GitClient) GetWorktreeChanges() (changes []GitWorktreeChange, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// status
+	status, err := wt.Status()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// changes
+	for filePath, fileStatus := range status {
+		change := GitWorktreeChange{Path: filePath}
+		switch {
+		case fileStatus.Worktree == git.Deleted || fileStatus.Staging == git.Deleted:
+			change.Status = GitDiffStatusDeleted
+		case fileStatus.Worktree == git.Untracked || fileStatus.Staging == git.Added:
+			change.Status = GitDiffStatusAdded
+		default:
+			change.Status = GitDiffStatusModified
+		}
+
+		// modification time (worktree filesystem, memfs for mem repos)
+		if change.Status != GitDiffStatusDeleted {
+			fi, err := wt.Filesystem.Stat(filePath)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			change.ModTime = fi.ModTime()
+		}
+
+		changes = append(changes, change)
+	}
+
+	// sort by path
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// GetStatusForPath returns the status of the files under prefix, a path relative
+// to the repo root, e.g. the directory of a single spider.
+func (c *GitClient) GetStatusForPath(prefix string) (statusList []GitFileStatus, err error) {
+	// status
+	list, err := c.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	// prefix
+	prefix = strings.Trim(path.Clean("/"+filepath.ToSlash(prefix)), "/")
+	if prefix == "" {
+		return list, nil
+	}
+
+	// filter
+	for _, s := range list {
+		if s.Path == prefix || strings.HasPrefix(s.Path, prefix+"/") {
+			statusList = append(statusList, s)
+		}
+	}
+
+	return statusList, nil
+}
+
+func (c *GitClient) AbortMerge() (err error) {
+	// in-progress merge state
+	inProgress := false
+	for _, name := range []plumbing.ReferenceName{GitMergeHead, GitCherryPickHead, GitRevertHead} {
+		if _, err := c.r.Reference(name, false); err == nil {
+			inProgress = true
+		} else if err != plumbing.ErrReferenceNotFound {
+			return trace.TraceError(err)
+		}
+	}
+	if !inProgress {
+		return trace.TraceError(ErrNoMergeInProgress)
+	}
+
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// reset worktree and index to HEAD
+	headRef, err := c.r.Head()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := wt.Reset(&git.ResetOptions{
+		Commit: headRef.Hash(),
+		Mode:   git.HardReset,
+	}); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return c.clearMergeState()
+}
+
+func (c *GitClient) GetWorktreeTreeHash() (hash string, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	// ignore patterns
+	patterns, err := gitignore.ReadPatterns(wt.Filesystem, nil)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	m := gitignore.NewMatcher(patterns)
+
+	// build tree objects in a throwaway storage so the repo is not touched
+	h, err := c.buildWorktreeTree(wt.Filesystem, memory.NewStorage(), m, nil)
+	if err != nil {
+		return "", err
+	}
+	if h.IsZero() {
+		// empty tree
+		h, err = c.storeTree(memory.NewStorage(), &object.Tree{})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return h.String(), nil
+}
+
+func (c *GitClient) Add(filePath string) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	if _, err := wt.Add(filePath); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) Move(from, to string) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// create destination directory if not exists
+	if dirPath := path.Dir(to); dirPath != "." {
+		if err := wt.Filesystem.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// move and stage
+	if _, err := wt.Move(from, to); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) ReadMemFile(filePath string) (data []byte, err error) {
+	// mem filesystem
+	fs, err := c.getMemFs()
+	if err != nil {
+		return nil, err
+	}
+
+	// read
+	data, err = util.ReadFile(fs, filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	return data, nil
+}
+
+func (c *GitClient) WriteMemFile(filePath string, data []byte) (err error) {
+	// mem filesystem
+	fs, err := c.getMemFs()
+	if err != nil {
+		return err
+	}
+
+	// create parent directory if not exists
+	if dirPath := path.Dir(filePath); dirPath != "." {
+		if err := fs.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// write
+	if err := util.WriteFile(fs, filePath, data, c.defaultFileMode); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+// GetConflictCount returns the number of conflicted paths, read from the unmerged
+// entries of the index without computing the worktree status.
+func (c *GitClient) GetConflictCount() (count int, err error) {
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+	paths := map[string]bool{}
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			paths[e.Name] = true
+		}
+	}
+	return len(paths), nil
+}
+
+func (c *GitClient) GetConflictVersions(filePath string) (base, ours, theirs []byte, err error) {
+	// index
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, nil, nil, trace.TraceError(err)
+	}
+
+	// conflict stages of the file (go-git's index.Merged constant is wrongly 1,
+	// so merged entries are detected by the zero stage instead)
+	isConflicted := false
+	for _, e := range idx.Entries {
+		if e.Name != filePath || e.Stage == 0 {
+			continue
+		}
+		isConflicted = true
+		data, err := c.getBlobContent(e.Hash)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch e.Stage {
+		case index.AncestorMode:
+			base = data
+		case index.OurMode:
+			ours = data
+		case index.TheirMode:
+			theirs = data
+		}
+	}
+	if !isConflicted {
+		return nil, nil, nil, trace.TraceError(ErrNoConflict)
+	}
+
+	return base, ours, theirs, nil
+}
+
+func (c *GitClient) ResolveConflict(filePath string, content []byte) (err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// write resolved content
+	if err := util.WriteFile(wt.Filesystem, filePath, content, c.defaultFileMode); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// clear conflict stages
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	var entries []*index.Entry
+	for _, e := range idx.Entries {
+		if e.Name == filePath && e.Stage != 0 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	idx.Entries = entries
+	if err := c.r.Storer.SetIndex(idx); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// stage
+	if _, err := wt.Add(filePath); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) ContinueMerge(msg string) (err error) {
+	// validate no conflicts remain
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return trace.TraceError(ErrUnresolvedConflicts)
+		}
+	}
+
+	// parents
+	headRef, err := c.r.Head()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	parents := []plumbing.Hash{headRef.Hash()}
+	mergeHeadRef, err := c.r.Reference(GitMergeHead, false)
+	if err == nil {
+		parents = append(parents, mergeHeadRef.Hash())
+	} else if err != plumbing.ErrReferenceNotFound {
+		return trace.TraceError(err)
+	}
+
+	// message
+	if msg == "" {
+		data, err := c.readGitFile(GitMergeMsg)
+		if err != nil {
+			return err
+		}
+		msg = string(data)
+	}
+
+	// commit
+	if err := c.Commit(msg, WithParents(parents)); err != nil {
+		return err
+	}
+
+	// clear merge state
+	return c.clearMergeState()
+}
+
+func (c *GitClient) GetRemote(name string) (r *git.Remote, err error) {
+	return c.r.Remote(name)
+}
+
+func (c *GitClient) CreateRemote(cfg *config.RemoteConfig) (r *git.Remote, err error) {
 	return c.r.CreateRemote(cfg)
 }
 
-func (c *GitClient) DeleteRemote(name string) (err error) {
-	return c.r.DeleteRemote(name)
+func (c *GitClient) AddRemote(name, url string) (err error) {
+	return c.createRemote(name, url, nil)
+}
+
+func (c *GitClient) DeleteRemote(name string) (err error) {
+	return c.r.DeleteRemote(name)
+}
+
+func (c *GitClient) ReplaceRemoteHost(oldHost, newHost string) (err error) {
+	// config
+	cfg, err := c.r.Config()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// rewrite remote urls
+	for _, remoteCfg := range cfg.Remotes {
+		for i, url := range remoteCfg.URLs {
+			remoteCfg.URLs[i] = replaceUrlHost(url, oldHost, newHost)
+		}
+	}
+
+	// persist config
+	if err := c.r.SetConfig(cfg); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// remote url
+	c.remoteUrl = replaceUrlHost(c.remoteUrl, oldHost, newHost)
+
+	return nil
+}
+
+func (c *GitClient) IsRemoteChanged() (ok bool, err error) {
+	return c.isRemoteChanged()
+}
+
+func (c *GitClient) isTrustedPath() bool {
+	repoPath, err := filepath.Abs(c.path)
+	if err != nil {
+		return false
+	}
+	for _, p := range c.trustedPaths {
+		if p == "*" {
+			return true
+		}
+		trustedPath, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		if trustedPath == repoPath {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *GitClient) commit(msg string, o *GitCommitOptions) (hash plumbing.Hash, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return hash, trace.TraceError(err)
+	}
+
+	// sign key
+	if o.SignKey == nil {
+		o.SignKey = c.signEntity
+	}
+
+	// stage modified and deleted files first, so the staged tree can be checked
+	if o.All {
+		if err := c.addModifiedAndDeleted(wt); err != nil {
+			return hash, err
+		}
+		o.All = false
+	}
+
+	// message
+	if msg == "" {
+		msg, err = c.renderCommitMessage(wt, &o.CommitOptions)
+		if err != nil {
+			return hash, err
+		}
+	}
+
+	// refuse a commit not changing the tree of HEAD unless allowed (merge commits
+	// with explicit parents excepted)
+	if !o.AllowEmptyCommits && len(o.Parents) == 0 {
+		if err := c.validateIndexChanged(); err != nil {
+			return hash, err
+		}
+	}
+
+	// commit
+	hash, err = wt.Commit(msg, &o.CommitOptions)
+	if err != nil {
+		return hash, trace.TraceError(err)
+	}
+
+	return hash, nil
+}
+
+func (c *GitClient) encodeIndex() (data []byte, err error) {
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := index.NewEncoder(buf).Encode(idx); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *GitClient) decodeIndex(data []byte) (err error) {
+	idx := &index.Index{}
+	if err := index.NewDecoder(bytes.NewReader(data)).Decode(idx); err != nil {
+		return trace.TraceError(err)
+	}
+	if err := c.r.Storer.SetIndex(idx); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+func (c *GitClient) getBundleRefs(refs []string) (bundleRefs []*plumbing.Reference, err error) {
+	// all branches and tags plus HEAD by default
+	if len(refs) == 0 {
+		iter, err := c.r.References()
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		if err := iter.ForEach(func(r *plumbing.Reference) error {
+			if r.Type() == plumbing.HashReference && (r.Name().IsBranch() || r.Name().IsTag()) {
+				bundleRefs = append(bundleRefs, r)
+			}
+			return nil
+		}); err != nil {
+			return nil, trace.TraceError(err)
+		}
+		if headRef, err := c.r.Head(); err == nil {
+			bundleRefs = append(bundleRefs, plumbing.NewHashReference(plumbing.HEAD, headRef.Hash()))
+		}
+		return bundleRefs, nil
+	}
+
+	// resolve names (annotated tags keep their tag objects)
+	for _, ref := range refs {
+		var bundleRef *plumbing.Reference
+		for _, name := range []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+			plumbing.ReferenceName(ref),
+		} {
+			r, err := c.r.Reference(name, true)
+			if err == plumbing.ErrReferenceNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			bundleRef = plumbing.NewHashReference(name, r.Hash())
+			break
+		}
+		if bundleRef == nil {
+			return nil, trace.TraceError(plumbing.ErrReferenceNotFound)
+		}
+		bundleRefs = append(bundleRefs, bundleRef)
+	}
+	return bundleRefs, nil
+}
+
+// removeAll removes p, retrying as configured by WithDisposeRetry.
+func (c *GitClient) removeAll(p string) (err error) {
+	for attempt := 0; ; attempt++ {
+		err = os.RemoveAll(p)
+		if err == nil || attempt >= c.disposeRetryAttempts {
+			return err
+		}
+		c.logEvent(GitLogLevelError, "remove failed, retrying", "path", p, "attempt", attempt+1, "error", err.Error())
+		time.Sleep(c.disposeRetryDelay)
+	}
+}
+
+func (c *GitClient) getInitLockKey() (key string) {
+	if c.getInitType() == GitInitTypeMem {
+		return "mem:" + c.path
+	}
+	absPath, err := filepath.Abs(c.path)
+	if err != nil {
+		absPath = c.path
+	}
+	return "fs:" + absPath
+}
+
+func (c *GitClient) initMem() (err error) {
+	// validate options
+	if !c.isMem || c.path == "" {
+		return trace.TraceError(ErrInvalidOptions)
+	}
+
+	// get storage and worktree
+	storage, wt := c.getMemStorageAndMemFs(c.path)
+
+	// attempt to init
+	c.r, err = git.InitWithOptions(storage, wt, git.InitOptions{
+		DefaultBranch: plumbing.NewBranchReferenceName(GetDefaultBranchName()),
+	})
+	if err != nil {
+		if err == git.ErrRepositoryAlreadyExists {
+			// if already exists, attempt to open
+			c.r, err = git.Open(storage, wt)
+			if err != nil {
+				return trace.TraceError(err)
+			}
+		} else {
+			return trace.TraceError(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *GitClient) initFs() (err error) {
+	// validate options
+	if c.path == "" {
+		return trace.TraceError(ErrInvalidOptions)
+	}
+
+	// extended-length path for long paths on windows
+	longPath := getLongPath(c.path)
+
+	// create directory if not exists
+	_, err = os.Stat(longPath)
+	if err != nil {
+		if c.noCreate && os.IsNotExist(err) {
+			return trace.TraceError(ErrRepoPathNotExists)
+		}
+		if err := os.MkdirAll(longPath, c.repoDirMode); err != nil {
+			return trace.TraceError(getFsError(err))
+		}
+		if err := os.Chmod(longPath, c.repoDirMode); err != nil {
+			return trace.TraceError(getFsError(err))
+		}
+		err = nil
+	}
+
+	// resolve symlinks (the link itself is kept as the client path)
+	c.realPath, err = filepath.EvalSymlinks(longPath)
+	if err != nil {
+		return trace.TraceError(getFsError(err))
+	}
+	c.realPath = getLongPath(c.realPath)
+
+	// try to open repo
+	c.r, err = git.PlainOpen(c.realPath)
+	if err == git.ErrRepositoryNotExists {
+		// refuse to nest inside an existing repo
+		if c.noNestedRepo {
+			if _, ok, err := FindRepoRoot(filepath.Dir(c.realPath)); err != nil {
+				return err
+			} else if ok {
+				return trace.TraceError(ErrNestedRepo)
+			}
+		}
+
+		// repo not exists, init
+		c.r, err = git.PlainInit(c.realPath, false)
+		if err != nil {
+			return trace.TraceError(getFsError(err))
+		}
+
+		// point HEAD to default branch
+		if err := setDefaultBranchHead(c.r); err != nil {
+			return trace.TraceError(err)
+		}
+
+		// permissions
+		if err := chmodRepo(filepath.Join(c.realPath, git.GitDirName), c.repoFileMode, c.repoDirMode); err != nil {
+			return trace.TraceError(err)
+		}
+	} else if err != nil {
+		// error
+		return trace.TraceError(getFsError(err))
+	}
+
+	return nil
+}
+
+func (c *GitClient) clone() (err error) {
+	// validate
+	if c.remoteUrl == "" {
+		return trace.TraceError(ErrUnableToCloneWithEmptyRemoteUrl)
+	}
+
+	// auth
+	auth, err := c.getGitAuth(c.remoteUrl)
+	if err != nil {
+		return err
+	}
+
+	// options
+	o := &git.CloneOptions{
+		URL:  c.remoteUrl,
+		Auth: auth,
+	}
+
+	// clone
+	ctx, done := c.startOperation()
+	defer done()
+	c.logEvent(GitLogLevelInfo, "clone started", "url", redactUrl(c.remoteUrl))
+	_, err = git.PlainCloneContext(ctx, c.path, false, o)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	c.logResult("clone finished", err)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) getInitType() (res GitInitType) {
+	if c.isMem {
+		return GitInitTypeMem
+	} else {
+		return GitInitTypeFs
+	}
+}
+
+func (c *GitClient) createRemote(remoteName string, url string, fetch []config.RefSpec) (err error) {
+	_, err = c.r.CreateRemote(&config.RemoteConfig{
+		Name:  remoteName,
+		URLs:  []string{url},
+		Fetch: fetch,
+	})
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	return
+}
+
+func (c *GitClient) getMemStorageAndMemFs(key string) (storage *memory.Storage, fs billy.Filesystem) {
+	// storage
+	storageItem, ok := GitMemStorages.Load(key)
+	if !ok {
+		storage = memory.NewStorage()
+		GitMemStorages.Store(key, storage)
+	} else {
+		switch storageItem.(type) {
+		case *memory.Storage:
+			storage = storageItem.(*memory.Storage)
+		default:
+			storage = memory.NewStorage()
+			GitMemStorages.Store(key, storage)
+		}
+	}
+
+	// file system
+	fsItem, ok := GitMemFileSystem.Load(key)
+	if !ok {
+		fs = memfs.New()
+		GitMemFileSystem.Store(key, fs)
+	} else {
+		switch fsItem.(type) {
+		case billy.Filesystem:
+			fs = fsItem.(billy.Filesystem)
+		default:
+			fs = memfs.New()
+			GitMemFileSystem.Store(key, fs)
+		}
+	}
+
+	return storage, fs
+}
+
+func (c *GitClient) getMemFs() (fs billy.Filesystem, err error) {
+	if !c.isMem {
+		return nil, trace.TraceError(ErrNotMemRepo)
+	}
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return wt.Filesystem, nil
+}
+
+// getOperationRemoteUrl returns remoteUrl if an operation overrides the url of the
+// remote with it, or the url of the remote otherwise.
+func (c *GitClient) getOperationRemoteUrl(remoteName, remoteUrl string) (url string) {
+	if remoteUrl != "" {
+		return remoteUrl
+	}
+	return c.getRemoteUrl(remoteName)
+}
+
+// getRemoteUrl returns the url of the remote, or the client's remote url if the
+// remote is not configured.
+func (c *GitClient) getRemoteUrl(remoteName string) (url string) {
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
+	}
+	r, err := c.r.Remote(remoteName)
+	if err != nil || len(r.Config().URLs) == 0 {
+		return c.remoteUrl
+	}
+	return r.Config().URLs[0]
+}
+
+// getGitAuth returns the auth method for remoteUrl, carrying the http settings of
+// the client if it is an http url.
+func (c *GitClient) getGitAuth(remoteUrl string) (auth transport.AuthMethod, err error) {
+	auth, err = c.getBaseGitAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	// carry http settings to the http transport
+	if (c.httpTransport != nil || len(c.httpHeaders) > 0) && isHttpUrl(remoteUrl) {
+		a, _ := auth.(http.AuthMethod)
+		return &gitHttpAuth{auth: a, transport: c.httpTransport, headers: c.httpHeaders}, nil
+	}
+
+	return auth, nil
+}
+
+func (c *GitClient) getBaseGitAuth() (auth transport.AuthMethod, err error) {
+	switch c.authType {
+	case GitAuthTypeNone:
+		c.logEvent(GitLogLevelDebug, "auth selected", "type", "none")
+		return nil, nil
+	case GitAuthTypeHTTP:
+		if c.username == "" && c.password == "" {
+			c.logEvent(GitLogLevelDebug, "auth selected", "type", "none")
+			return nil, nil
+		}
+		c.logEvent(GitLogLevelDebug, "auth selected", "type", "http")
+		auth = &http.BasicAuth{
+			Username: c.username,
+			Password: c.password,
+		}
+		return auth, nil
+	case GitAuthTypeSSH:
+		var privateKeyData []byte
+		if c.privateKey != "" {
+			// private key content
+			c.logEvent(GitLogLevelDebug, "auth selected", "type", "ssh", "key_source", "content")
+			privateKeyData = []byte(c.privateKey)
+		} else if c.privateKeyPath != "" {
+			// read from private key file
+			c.logEvent(GitLogLevelDebug, "auth selected", "type", "ssh", "key_source", "path")
+			privateKeyData, err = ioutil.ReadFile(c.privateKeyPath)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+		} else {
+			// no private key
+			c.logEvent(GitLogLevelDebug, "auth selected", "type", "none")
+			return nil, nil
+		}
+		signer, err := ssh.ParsePrivateKey(privateKeyData)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		auth = &gitssh.PublicKeys{
+			User:   c.username,
+			Signer: signer,
+			HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
+				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			},
+		}
+		return auth, nil
+	default:
+		return nil, trace.TraceError(ErrInvalidAuthType)
+	}
+}
+
+// loadSignKey parses the key set by WithSignKeyFile or WithSignKeyBytes, decrypting
+// it with the passphrase, and caches it for signing commits.
+func (c *GitClient) loadSignKey() (err error) {
+	if c.signEntity != nil {
+		return nil
+	}
+
+	// armored key data
+	keyData := c.signKey
+	if len(keyData) == 0 {
+		if c.signKeyPath == "" {
+			return nil
+		}
+		keyData, err = ioutil.ReadFile(c.signKeyPath)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// entity
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyData))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return trace.TraceError(ErrInvalidSignKey)
+	}
+	entity := entities[0]
+
+	// decrypt
+	if entity.PrivateKey.Encrypted {
+		if err := entity.DecryptPrivateKeys([]byte(c.signKeyPassphrase)); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	c.signEntity = entity
+	return nil
+}
+
+func (c *GitClient) logEvent(level, msg string, kv ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+	c.logger(level, msg, kv...)
+}
+
+func (c *GitClient) logResult(msg string, err error) {
+	if err != nil {
+		c.logEvent(GitLogLevelError, msg, "error", err.Error())
+		return
+	}
+	c.logEvent(GitLogLevelInfo, msg)
+}
+
+// pullMerge merges the diverged remote-tracking branch into HEAD, resolving
+// conflicts with the conflict strategy of the pull options.
+func (c *GitClient) pullMerge(o *GitPullOptions) (err error) {
+	// remote name
+	remoteName := o.RemoteName
+	if remoteName == "" {
+		remoteName = GitRemoteNameOrigin
+	}
+
+	// branch name
+	branch := o.ReferenceName.Short()
+	if o.ReferenceName == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return err
+		}
+	}
+
+	// remote-tracking ref
+	remoteRef, err := c.r.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	msg := fmt.Sprintf("Merge branch '%s' of %s", branch, remoteName)
+	return c.mergeWithStrategy(remoteRef.Hash(), o.ConflictStrategy, msg)
+}
+
+// mergeWithStrategy merges the commit theirsHash into HEAD and commits the result.
+// Files changed on one side only take that side's version. Text files changed on
+// both sides are merged line by line, taking the side of strategy only for changes
+// to the same lines. Binary files, and files deleted on one side and changed on the
+// other, are resolved as a whole by taking the side of strategy.
+func (c *GitClient) mergeWithStrategy(theirsHash plumbing.Hash, strategy, msg string) (err error) {
+	// validate strategy
+	if strategy != GitConflictStrategyOurs && strategy != GitConflictStrategyTheirs {
+		return trace.TraceError(ErrInvalidOptions)
+	}
+
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := c.validateWorktreeClean(wt); err != nil {
+		return err
+	}
+
+	// commits
+	headRef, err := c.r.Head()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	ours, err := c.r.CommitObject(headRef.Hash())
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	theirs, err := c.r.CommitObject(theirsHash)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// files of each side
+	oursFiles, err := c.getCommitFiles(ours)
+	if err != nil {
+		return err
+	}
+	theirsFiles, err := c.getCommitFiles(theirs)
+	if err != nil {
+		return err
+	}
+	baseFiles := map[string]*object.File{}
+	if len(bases) > 0 {
+		baseFiles, err = c.getCommitFiles(bases[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	// paths
+	paths := map[string]bool{}
+	for _, files := range []map[string]*object.File{oursFiles, theirsFiles, baseFiles} {
+		for filePath := range files {
+			paths[filePath] = true
+		}
+	}
+
+	// apply their changes to the worktree and index
+	for filePath := range paths {
+		b, o, t := baseFiles[filePath], oursFiles[filePath], theirsFiles[filePath]
+		if isSameFile(o, t) || isSameFile(b, t) {
+			// unchanged on their side
+			continue
+		}
+		if isSameFile(b, o) {
+			// unchanged on our side
+			if err := c.checkoutFile(wt, filePath, t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// changed on both sides
+		ok, err := c.mergeFile(wt, filePath, b, o, t, strategy)
+		if err != nil {
+			return err
+		}
+		if ok || strategy == GitConflictStrategyOurs {
+			continue
+		}
+		if err := c.checkoutFile(wt, filePath, t); err != nil {
+			return err
+		}
+	}
+
+	return c.Commit(msg, WithParents([]plumbing.Hash{ours.Hash, theirs.Hash}))
+}
+
+// mergeFile merges the changes of ours and theirs to base, which is nil if the file
+// was added on both sides, into filePath of the worktree and stages it. It reports
+// false, leaving the file as is, if ours or theirs is deleted, a symlink or binary.
+func (c *GitClient) mergeFile(wt *git.Worktree, filePath string, base, ours, theirs *object.File, strategy string) (ok bool, err error) {
+	if ours == nil || theirs == nil || ours.Mode == filemode.Symlink || theirs.Mode == filemode.Symlink {
+		return false, nil
+	}
+
+	// contents
+	var contents [][]byte
+	for _, f := range []*object.File{base, ours, theirs} {
+		if f == nil {
+			contents = append(contents, nil)
+			continue
+		}
+		data, err := c.getBlobContent(f.Hash)
+		if err != nil {
+			return false, err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return false, nil
+		}
+		contents = append(contents, data)
+	}
+	data := mergeLines(contents[0], contents[1], contents[2], strategy)
+
+	// mode (changed on one side, or conflicting and resolved with strategy)
+	mode := ours.Mode
+	switch {
+	case base != nil && base.Mode == ours.Mode:
+		mode = theirs.Mode
+	case base != nil && base.Mode == theirs.Mode:
+	case strategy == GitConflictStrategyTheirs:
+		mode = theirs.Mode
+	}
+	perm, err := mode.ToOSFileMode()
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+
+	// write and stage
+	if err := util.WriteFile(wt.Filesystem, filePath, data, perm); err != nil {
+		return false, trace.TraceError(err)
+	}
+	if _, err := wt.Add(filePath); err != nil {
+		return false, trace.TraceError(err)
+	}
+
+	return true, nil
+}
+
+func (c *GitClient) getCommitFiles(commit *object.Commit) (files map[string]*object.File, err error) {
+	files = map[string]*object.File{}
+	iter, err := commit.Files()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := iter.ForEach(func(f *object.File) error {
+		files[f.Name] = f
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return files, nil
+}
+
+// checkoutFile writes f to filePath of the worktree and stages it, or removes
+// filePath if f is nil.
+func (c *GitClient) checkoutFile(wt *git.Worktree, filePath string, f *object.File) (err error) {
+	// remove
+	if f == nil {
+		if _, err := wt.Remove(filePath); err != nil {
+			return trace.TraceError(err)
+		}
+		return nil
+	}
+
+	// write
+	if err := c.writeTreeFile(wt.Filesystem, filePath, f); err != nil {
+		return err
+	}
+
+	// stage
+	if _, err := wt.Add(filePath); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+// writeTreeFile writes the content of f to filePath of fs with its mode, creating
+// parent directories as needed.
+func (c *GitClient) writeTreeFile(fs billy.Filesystem, filePath string, f *object.File) (err error) {
+	// content
+	data, err := c.getBlobContent(f.Hash)
+	if err != nil {
+		return err
+	}
+
+	// write
+	if dirPath := path.Dir(filePath); dirPath != "." {
+		if err := fs.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	if f.Mode == filemode.Symlink {
+		_ = fs.Remove(filePath)
+		if err := fs.Symlink(string(data), filePath); err != nil {
+			return trace.TraceError(err)
+		}
+		return nil
+	}
+	perm, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := util.WriteFile(fs, filePath, data, perm); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+func (c *GitClient) validateWorktreeClean(wt *git.Worktree) (err error) {
+	status, err := wt.Status()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	for _, fileStatus := range status {
+		if fileStatus.Worktree != git.Untracked && (fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified) {
+			return trace.TraceError(ErrWorktreeNotClean)
+		}
+	}
+	return nil
+}
+
+func (c *GitClient) fetchAndFastForward(ctx context.Context, o *GitPullOptions) (err error) {
+	// remote name
+	if o.RemoteName == "" {
+		o.RemoteName = GitRemoteNameOrigin
+	}
+
+	// fetch
+	updated := true
+	if err := c.r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName:      o.RemoteName,
+		RemoteURL:       o.RemoteURL,
+		Depth:           o.Depth,
+		Auth:            o.Auth,
+		Progress:        o.Progress,
+		Tags:            o.Tags,
+		Force:           o.Force,
+		InsecureSkipTLS: o.InsecureSkipTLS,
+		CABundle:        o.CABundle,
+	}); err != nil {
+		if err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+		updated = false
+	}
+
+	// branch name
+	branch := o.ReferenceName.Short()
+	if o.ReferenceName == "" {
+		branch, err = c.GetCurrentBranch()
+		if err != nil {
+			return err
+		}
+	}
+
+	// remote-tracking ref
+	remoteRef, err := c.r.Reference(plumbing.NewRemoteReferenceName(o.RemoteName, branch), true)
+	if err != nil {
+		return err
+	}
+
+	// fast-forward check
+	headRef, err := c.r.Head()
+	if err == nil {
+		ok, err := c.isAncestor(remoteRef.Hash(), headRef.Hash())
+		if err != nil {
+			return err
+		}
+		if ok && !updated {
+			return git.NoErrAlreadyUpToDate
+		}
+		if ok {
+			return nil
+		}
+		ok, err = c.isAncestor(headRef.Hash(), remoteRef.Hash())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return git.ErrNonFastForwardUpdate
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	// update branch and worktree
+	return c.fastForward(remoteRef.Hash())
+}
+
+// fastForward moves the branch HEAD points to onto hash and updates the worktree.
+func (c *GitClient) fastForward(hash plumbing.Hash) (err error) {
+	headRef, err := c.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	}
+	if headRef.Type() == plumbing.SymbolicReference {
+		err = c.r.Storer.SetReference(plumbing.NewHashReference(headRef.Target(), hash))
+	} else {
+		err = c.r.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash))
+	}
+	if err != nil {
+		return err
+	}
+
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return err
+	}
+	return wt.Reset(&git.ResetOptions{
+		Commit: hash,
+		Mode:   git.MergeReset,
+	})
+}
+
+func (c *GitClient) isAncestor(ancestor, descendant plumbing.Hash) (ok bool, err error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+	ancestorCommit, err := c.r.CommitObject(ancestor)
+	if err != nil {
+		return false, err
+	}
+	descendantCommit, err := c.r.CommitObject(descendant)
+	if err != nil {
+		return false, err
+	}
+	return ancestorCommit.IsAncestor(descendantCommit)
+}
+
+func noopRecordOpDone(err *error) {}
+
+// recordOp records the start of the operation name with the metrics recorder and
+// returns the func to defer with the operation error to record its end.
+func (c *GitClient) recordOp(name string) (done func(err *error)) {
+	if c.metrics == nil {
+		return noopRecordOpDone
+	}
+	start := time.Now()
+	c.metrics.IncOp(name)
+	return func(err *error) {
+		c.metrics.ObserveDuration(name, time.Since(start))
+		if *err != nil {
+			c.metrics.IncError(name)
+		}
+	}
+}
+
+// startOperation returns the context of a network operation, which Cancel cancels,
+// and the func to call once the operation is done.
+func (c *GitClient) startOperation() (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
+	if c.opCancels == nil {
+		c.opCancels = map[int]context.CancelFunc{}
+	}
+	c.opSeq++
+	id := c.opSeq
+	c.opCancels[id] = cancel
+	return ctx, func() {
+		c.opMu.Lock()
+		defer c.opMu.Unlock()
+		delete(c.opCancels, id)
+		cancel()
+	}
+}
+
+func (c *GitClient) fetchShallowSince(ctx context.Context, o *GitFetchOptions) (err error) {
+	// remote
+	if o.RemoteName == "" {
+		o.RemoteName = GitRemoteNameOrigin
+	}
+	remote, err := c.r.Remote(o.RemoteName)
+	if err != nil {
+		return err
+	}
+	if o.RemoteURL == "" {
+		o.RemoteURL = remote.Config().URLs[0]
+	}
+	if len(o.RefSpecs) == 0 {
+		o.RefSpecs = remote.Config().Fetch
+	}
+
+	// upload-pack session
+	ep, err := transport.NewEndpoint(o.RemoteURL)
+	if err != nil {
+		return err
+	}
+	cli, err := client.NewClient(ep)
+	if err != nil {
+		return err
+	}
+	sess, err := cli.NewUploadPackSession(ep, o.Auth)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	// advertised references
+	ar, err := sess.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	// fall back to a normal fetch if the server cannot deepen by date
+	if !ar.Capabilities.Supports(capability.DeepenSince) {
+		return c.r.FetchContext(ctx, &o.FetchOptions)
+	}
+
+	// remote references matching refspecs
+	remoteRefs, err := ar.AllReferences()
+	if err != nil {
+		return err
+	}
+	refs := map[plumbing.ReferenceName]plumbing.Hash{}
+	forced := map[plumbing.ReferenceName]bool{}
+	for _, ref := range remoteRefs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		for _, rs := range o.RefSpecs {
+			if rs.Match(ref.Name()) {
+				refs[rs.Dst(ref.Name())] = ref.Hash()
+				forced[rs.Dst(ref.Name())] = forced[rs.Dst(ref.Name())] || rs.IsForceUpdate()
+			}
+		}
+	}
+
+	// request
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Depth = packp.DepthSince(o.ShallowSince)
+	if err := req.Capabilities.Set(capability.Shallow); err != nil {
+		return err
+	}
+	if err := req.Capabilities.Set(capability.DeepenSince); err != nil {
+		return err
+	}
+	if o.Progress == nil && ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+	req.Shallows, err = c.r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+	for _, hash := range refs {
+		if c.r.Storer.HasEncodedObject(hash) == nil {
+			continue
+		}
+		req.Wants = append(req.Wants, hash)
+	}
+	if len(req.Wants) == 0 {
+		// refs may still move to objects already fetched
+		updated, err := c.updateFetchedRefs(refs, forced, o.Force)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return git.NoErrAlreadyUpToDate
+		}
+		return nil
+	}
+	localRefs, err := c.r.References()
+	if err != nil {
+		return err
+	}
+	_ = localRefs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && c.r.Storer.HasEncodedObject(ref.Hash()) == nil {
+			req.Haves = append(req.Haves, ref.Hash())
+		}
+		return nil
+	})
+
+	// upload pack
+	res, err := sess.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	// shallow boundaries (the server may send known ones again)
+	if len(res.Shallows) > 0 {
+		shallows := req.Shallows
+		for _, hash := range res.Shallows {
+			if !containsHash(shallows, hash) {
+				shallows = append(shallows, hash)
+			}
+		}
+		if err := c.r.Storer.SetShallow(shallows); err != nil {
+			return err
+		}
+	}
+
+	// objects
+	var reader io.Reader = res
+	if req.Capabilities.Supports(capability.Sideband64k) {
+		d := sideband.NewDemuxer(sideband.Sideband64k, res)
+		d.Progress = o.Progress
+		reader = d
+	} else if req.Capabilities.Supports(capability.Sideband) {
+		d := sideband.NewDemuxer(sideband.Sideband, res)
+		d.Progress = o.Progress
+		reader = d
+	}
+	if err := packfile.UpdateObjectStorage(c.r.Storer, reader); err != nil {
+		return err
+	}
+
+	// update local references
+	_, err = c.updateFetchedRefs(refs, forced, o.Force)
+	return err
+}
+
+// updateFetchedRefs points the local refs of refs to their fetched hashes. Refs that
+// would not be fast-forwarded are left as is unless their refspec starts with "+" or
+// force is set, returning git.ErrForceNeeded after updating the others.
+func (c *GitClient) updateFetchedRefs(refs map[plumbing.ReferenceName]plumbing.Hash, forced map[plumbing.ReferenceName]bool, force bool) (updated bool, err error) {
+	forceNeeded := false
+	for name, hash := range refs {
+		old, err := c.r.Storer.Reference(name)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return updated, err
+		}
+		if old != nil && old.Hash() == hash {
+			continue
+		}
+		if old != nil && !force && !forced[name] {
+			ok, err := c.isFastForward(old.Hash(), hash)
+			if err != nil {
+				return updated, err
+			}
+			if !ok {
+				forceNeeded = true
+				continue
+			}
+		}
+		if err := c.r.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return updated, err
+		}
+		updated = true
+	}
+	if forceNeeded {
+		return updated, git.ErrForceNeeded
+	}
+	return updated, nil
+}
+
+// isFastForward reports whether old is reachable from new. Unlike isAncestor it
+// works in shallow repos, stopping at shallow commits and missing parents.
+func (c *GitClient) isFastForward(old, new plumbing.Hash) (ok bool, err error) {
+	shallows, err := c.r.Storer.Shallow()
+	if err != nil {
+		return false, err
+	}
+	seen := map[plumbing.Hash]bool{}
+	queue := []plumbing.Hash{new}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == old {
+			return true, nil
+		}
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if containsHash(shallows, hash) {
+			continue
+		}
+		commit, err := c.r.CommitObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		queue = append(queue, commit.ParentHashes...)
+	}
+	return false, nil
+}
+
+func (c *GitClient) getRefType(name plumbing.ReferenceName) (refType string) {
+	switch {
+	case name.IsBranch():
+		return GitRefTypeBranch
+	case name.IsTag():
+		return GitRefTypeTag
+	case name.IsRemote():
+		return GitRefTypeRemote
+	case name.IsNote():
+		return GitRefTypeNote
+	default:
+		return GitRefTypeOther
+	}
+}
+
+func (c *GitClient) getStatusString(statusCode git.StatusCode) (code string) {
+	return string(statusCode)
+	//switch statusCode {
+	//}
+	//Unmodified         StatusCode = ' '
+	//Untracked          StatusCode = '?'
+	//Modified           StatusCode = 'M'
+	//Added              StatusCode = 'A'
+	//Deleted            StatusCode = 'D'
+	//Renamed            StatusCode = 'R'
+	//Copied             StatusCode = 'C'
+	//UpdatedButUnmerged StatusCode = 'U'
+}
+
+func (c *GitClient) getDirPaths(filePath string) (paths []string) {
+	pathItems := strings.Split(filePath, "/")
+
+	var items []string
+	for i, pathItem := range pathItems {
+		if i == len(pathItems)-1 {
+			continue
+		}
+		items = append(items, pathItem)
+		dirPath := strings.Join(items, "/")
+		paths = append(paths, dirPath)
+	}
+
+	return paths
+}
+
+// checkoutRemoteDefaultBranch fetches and checks out the branch HEAD of the remote
+// points to, if HEAD of the local repo is unresolved (no commits yet).
+func (c *GitClient) checkoutRemoteDefaultBranch(remoteName string) (err error) {
+	// skip if HEAD is resolved
+	if _, err := c.r.Head(); err == nil {
+		return nil
+	} else if err != plumbing.ErrReferenceNotFound {
+		return trace.TraceError(err)
+	}
+
+	// remote default branch
+	branch, err := c.getRemoteDefaultBranch(remoteName)
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		return nil
+	}
+
+	// fetch
+	if err := c.Fetch(WithRemoteNameFetch(remoteName)); err != nil {
+		return err
+	}
+
+	return c.CheckoutBranchWithRemote(branch, remoteName, nil)
+}
+
+// getRemoteDefaultBranch returns the branch HEAD of the remote points to, or an
+// empty string if the remote is empty.
+func (c *GitClient) getRemoteDefaultBranch(remoteName string) (branch string, err error) {
+	// remote
+	r, err := c.r.Remote(remoteName)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	// auth
+	auth, err := c.getGitAuth(c.getRemoteUrl(remoteName))
+	if err != nil {
+		return "", err
+	}
+
+	// refs
+	ctx, done := c.startOperation()
+	defer done()
+	refs, err := r.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		if err == transport.ErrEmptyRemoteRepository {
+			return "", nil
+		}
+		return "", trace.TraceError(err)
+	}
+
+	// HEAD symref
+	var headHash plumbing.Hash
+	for _, ref := range refs {
+		if ref.Name() != plumbing.HEAD {
+			continue
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+		headHash = ref.Hash()
+	}
+
+	// no symref advertised, match HEAD hash with branches
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == headHash {
+			branch = ref.Name().Short()
+			if branch == GetDefaultBranchName() {
+				break
+			}
+		}
+	}
+
+	return branch, nil
+}
+
+func (c *GitClient) createBranch(branch, remote string, ref *plumbing.Reference) (err error) {
+	// create a new branch if it does not exist
+	cfg := config.Branch{
+		Name:   branch,
+		Remote: remote,
+	}
+	if err := c.r.CreateBranch(&cfg); err != nil {
+		return err
+	}
+	// if ref is nil
+	if ref == nil {
+		// try to set to remote ref of branch first
+		ref, err = c.getBranchHashRef(branch, remote)
+
+		// if no matched remote branch, set to HEAD
+		if err == ErrNoMatchedRemoteBranch {
+			ref, err = c.r.Head()
+			if err != nil {
+				return trace.TraceError(err)
+			}
+		}
+
+		// error
+		if err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// branch reference name
+	branchRefName := plumbing.NewBranchReferenceName(branch)
+
+	// branch reference
+	branchRef := plumbing.NewHashReference(branchRefName, ref.Hash())
+
+	// set HEAD to branch reference
+	if err := c.r.Storer.SetReference(branchRef); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *GitClient) getBranchHashRef(branch, remote string) (hashRef *plumbing.Reference, err error) {
+	refs, err := c.GetRemoteRefs(remote)
+	if err != nil {
+		return nil, err
+	}
+	var branchRef *GitRef
+	for _, r := range refs {
+		if r.Name == branch {
+			branchRef = &r
+			break
+		}
+	}
+	if branchRef == nil {
+		return nil, ErrNoMatchedRemoteBranch
+	}
+	branchHashRef := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), plumbing.NewHash(branchRef.Hash))
+	return branchHashRef, nil
+}
+
+func (c *GitClient) getGitLog(commit *object.Commit) (l GitLog) {
+	parentHashes := make([]string, len(commit.ParentHashes))
+	for i, h := range commit.ParentHashes {
+		parentHashes[i] = h.String()
+	}
+	authorName, authorEmail := c.getMailmapIdentity(commit.Author.Name, commit.Author.Email)
+	return GitLog{
+		Hash:         commit.Hash.String(),
+		Msg:          commit.Message,
+		AuthorName:   authorName,
+		AuthorEmail:  authorEmail,
+		Timestamp:    commit.Author.When,
+		ParentHashes: parentHashes,
+	}
+}
+
+// getMailmapIdentity returns the canonical identity of an author from the mailmap,
+// keeping the name if the mapping only specifies an email.
+func (c *GitClient) getMailmapIdentity(name, email string) (string, string) {
+	identity, ok := c.mailmap[strings.ToLower(email)]
+	if !ok {
+		return name, email
+	}
+	canonicalName, canonicalEmail := parseMailmapIdentity(identity)
+	if canonicalName == "" {
+		canonicalName = name
+	}
+	return canonicalName, canonicalEmail
+}
+
+// fsStorage returns the filesystem storage of fs repos, unwrapping the object cache.
+func (c *GitClient) fsStorage() (s *filesystem.Storage, ok bool) {
+	switch s := c.r.Storer.(type) {
+	case *filesystem.Storage:
+		return s, true
+	case *gitObjectCacheStorage:
+		return s.Storage, true
+	default:
+		return nil, false
+	}
+}
+
+// readGitFile reads a file in the .git directory of fs repos, returning nil data if absent.
+func (c *GitClient) readGitFile(name string) (data []byte, err error) {
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return nil, nil
+	}
+	data, err = util.ReadFile(fsStorage.Filesystem(), name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+	return data, nil
+}
+
+func (c *GitClient) isRefExists(name plumbing.ReferenceName) (ok bool, err error) {
+	if _, err := c.r.Reference(name, false); err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			return false, nil
+		}
+		return false, trace.TraceError(err)
+	}
+	return true, nil
 }
 
-func (c *GitClient) IsRemoteChanged() (ok bool, err error) {
-	return c.isRemoteChanged()
+func (c *GitClient) isGitFileExists(name string) (ok bool, err error) {
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return false, nil
+	}
+	if _, err := fsStorage.Filesystem().Stat(name); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, trace.TraceError(err)
+	}
+	return true, nil
 }
 
-func (c *GitClient) initMem() (err error) {
-	// validate options
-	if !c.isMem || c.path == "" {
-		return trace.TraceError(ErrInvalidOptions)
+func (c *GitClient) clearMergeState() (err error) {
+	// merge, cherry-pick and revert heads
+	for _, name := range []plumbing.ReferenceName{GitMergeHead, GitCherryPickHead, GitRevertHead} {
+		if err := c.r.Storer.RemoveReference(name); err != nil {
+			return trace.TraceError(err)
+		}
 	}
 
-	// get storage and worktree
-	storage, wt := c.getMemStorageAndMemFs(c.path)
+	// merge message and mode (fs repos only)
+	fsStorage, ok := c.fsStorage()
+	if !ok {
+		return nil
+	}
+	for _, name := range []string{GitMergeMsg, GitMergeMode} {
+		if err := fsStorage.Filesystem().Remove(name); err != nil && !os.IsNotExist(err) {
+			return trace.TraceError(err)
+		}
+	}
 
-	// attempt to init
-	c.r, err = git.Init(storage, wt)
+	return nil
+}
+
+// buildWorktreeTree stores the tree of the worktree directory at dirPath into s and
+// returns its hash, or a zero hash if the directory has no trackable content.
+func (c *GitClient) buildWorktreeTree(fs billy.Filesystem, s storer.EncodedObjectStorer, m gitignore.Matcher, dirPath []string) (hash plumbing.Hash, err error) {
+	dir := "."
+	if len(dirPath) > 0 {
+		dir = path.Join(dirPath...)
+	}
+	infos, err := fs.ReadDir(dir)
 	if err != nil {
-		if err == git.ErrRepositoryAlreadyExists {
-			// if already exists, attempt to open
-			c.r, err = git.Open(storage, wt)
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+
+	tree := &object.Tree{}
+	for _, fi := range infos {
+		// skip .git and ignored files
+		if len(dirPath) == 0 && fi.Name() == git.GitDirName {
+			continue
+		}
+		itemPath := append(append([]string{}, dirPath...), fi.Name())
+		if m.Match(itemPath, fi.IsDir()) {
+			continue
+		}
+
+		// sub directory
+		if fi.IsDir() {
+			h, err := c.buildWorktreeTree(fs, s, m, itemPath)
 			if err != nil {
-				return trace.TraceError(err)
+				return plumbing.ZeroHash, err
+			}
+			if h.IsZero() {
+				continue
+			}
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: fi.Name(), Mode: filemode.Dir, Hash: h})
+			continue
+		}
+
+		// file
+		mode, err := filemode.NewFromOSFileMode(fi.Mode())
+		if err != nil {
+			return plumbing.ZeroHash, trace.TraceError(err)
+		}
+		var data []byte
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := fs.Readlink(path.Join(itemPath...))
+			if err != nil {
+				return plumbing.ZeroHash, trace.TraceError(err)
 			}
+			data = []byte(target)
 		} else {
-			return trace.TraceError(err)
+			data, err = util.ReadFile(fs, path.Join(itemPath...))
+			if err != nil {
+				return plumbing.ZeroHash, trace.TraceError(err)
+			}
+		}
+		h, err := c.storeBlob(s, data)
+		if err != nil {
+			return plumbing.ZeroHash, err
 		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: fi.Name(), Mode: mode, Hash: h})
+	}
+	if len(tree.Entries) == 0 {
+		return plumbing.ZeroHash, nil
 	}
 
-	return nil
+	return c.storeTree(s, tree)
 }
 
-func (c *GitClient) initFs() (err error) {
-	// validate options
-	if c.path == "" {
-		return trace.TraceError(ErrInvalidOptions)
+type gitTreeBlob struct {
+	path string
+	hash plumbing.Hash
+}
+
+// getLargeTreeBlobs returns the blobs of large found in the tree treeHash with their
+// paths. Results are memoized per tree, as most subtrees are shared by consecutive
+// commits.
+func (c *GitClient) getLargeTreeBlobs(treeHash plumbing.Hash, large map[plumbing.Hash]*GitLargeObject, memo map[plumbing.Hash][]gitTreeBlob) (blobs []gitTreeBlob, err error) {
+	if blobs, ok := memo[treeHash]; ok {
+		return blobs, nil
+	}
+	tree, err := c.r.TreeObject(treeHash)
+	if err != nil {
+		return nil, trace.TraceError(err)
 	}
+	for _, entry := range tree.Entries {
+		if entry.Mode == filemode.Dir {
+			subBlobs, err := c.getLargeTreeBlobs(entry.Hash, large, memo)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range subBlobs {
+				blobs = append(blobs, gitTreeBlob{path: path.Join(entry.Name, b.path), hash: b.hash})
+			}
+			continue
+		}
+		if large[entry.Hash] != nil {
+			blobs = append(blobs, gitTreeBlob{path: entry.Name, hash: entry.Hash})
+		}
+	}
+	memo[treeHash] = blobs
+	return blobs, nil
+}
 
-	// create directory if not exists
-	_, err = os.Stat(c.path)
+// createTag creates the tag of spec, annotated if it has a message.
+func (c *GitClient) createTag(spec GitTagSpec) (ref *plumbing.Reference, err error) {
+	hash, err := c.r.ResolveRevision(plumbing.Revision(spec.TargetRef))
 	if err != nil {
-		if err := os.MkdirAll(c.path, os.ModePerm); err != nil {
-			return trace.TraceError(err)
+		return nil, err
+	}
+	var tagOpts *git.CreateTagOptions
+	if spec.Message != "" {
+		tagOpts = &git.CreateTagOptions{
+			Tagger:  spec.Tagger,
+			Message: spec.Message,
 		}
-		err = nil
 	}
+	return c.r.CreateTag(spec.Name, *hash, tagOpts)
+}
 
-	// try to open repo
-	c.r, err = git.PlainOpen(c.path)
-	if err == git.ErrRepositoryNotExists {
-		// repo not exists, init
-		c.r, err = git.PlainInit(c.path, false)
+// peelTag follows the tag objects starting at hash down to the commit they point to.
+func (c *GitClient) peelTag(hash plumbing.Hash) (commit *object.Commit, err error) {
+	for {
+		obj, err := c.r.Storer.EncodedObject(plumbing.AnyObject, hash)
 		if err != nil {
-			return trace.TraceError(err)
+			return nil, trace.TraceError(err)
+		}
+		switch obj.Type() {
+		case plumbing.TagObject:
+			tag, err := object.DecodeTag(c.r.Storer, obj)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			hash = tag.Target
+		case plumbing.CommitObject:
+			commit, err := object.DecodeCommit(c.r.Storer, obj)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			return commit, nil
+		default:
+			return nil, trace.TraceError(ErrTagNotCommit)
 		}
-	} else if err != nil {
-		// error
-		return trace.TraceError(err)
 	}
+}
 
-	return nil
+// rewordCommit rewrites hash with the message of target replaced by msg, and
+// returns the new hash, which equals hash if target is not among its ancestors.
+func (c *GitClient) rewordCommit(hash, target plumbing.Hash, msg string, rewritten map[plumbing.Hash]plumbing.Hash) (newHash plumbing.Hash, err error) {
+	if h, ok := rewritten[hash]; ok {
+		return h, nil
+	}
+	commit, err := c.r.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+
+	// parents
+	changed := hash == target
+	parentHashes := make([]plumbing.Hash, len(commit.ParentHashes))
+	for i, parentHash := range commit.ParentHashes {
+		parentHashes[i], err = c.rewordCommit(parentHash, target, msg, rewritten)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if parentHashes[i] != parentHash {
+			changed = true
+		}
+	}
+	if !changed {
+		rewritten[hash] = hash
+		return hash, nil
+	}
+
+	// new commit (signatures would no longer match, so they are dropped)
+	newCommit := &object.Commit{
+		Author:       commit.Author,
+		Committer:    commit.Committer,
+		Message:      commit.Message,
+		TreeHash:     commit.TreeHash,
+		ParentHashes: parentHashes,
+	}
+	if hash == target {
+		newCommit.Message = msg
+	}
+	obj := c.r.Storer.NewEncodedObject()
+	if err := newCommit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	newHash, err = c.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	rewritten[hash] = newHash
+
+	return newHash, nil
 }
 
-func (c *GitClient) clone() (err error) {
-	// validate
-	if c.remoteUrl == "" {
-		return trace.TraceError(ErrUnableToCloneWithEmptyRemoteUrl)
+// importCommit stores the tree and commit of ic on top of parentHash (zero for a root
+// commit) and returns the hash of the commit.
+func (c *GitClient) importCommit(ic GitImportCommit, parentHash plumbing.Hash) (hash plumbing.Hash, err error) {
+	// files of the parent
+	files := map[string]object.TreeEntry{}
+	var parentHashes []plumbing.Hash
+	if !parentHash.IsZero() {
+		parentCommit, err := c.r.CommitObject(parentHash)
+		if err != nil {
+			return plumbing.ZeroHash, trace.TraceError(err)
+		}
+		parentTree, err := parentCommit.Tree()
+		if err != nil {
+			return plumbing.ZeroHash, trace.TraceError(err)
+		}
+		if err := parentTree.Files().ForEach(func(f *object.File) error {
+			files[f.Name] = object.TreeEntry{Mode: f.Mode, Hash: f.Hash}
+			return nil
+		}); err != nil {
+			return plumbing.ZeroHash, trace.TraceError(err)
+		}
+		parentHashes = append(parentHashes, parentHash)
 	}
 
-	// auth
-	auth, err := c.getGitAuth()
+	// apply files
+	for filePath, data := range ic.Files {
+		filePath = strings.Trim(path.Clean("/"+filepath.ToSlash(filePath)), "/")
+		if data == nil {
+			delete(files, filePath)
+			continue
+		}
+		h, err := c.storeBlob(c.r.Storer, data)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		mode := filemode.Regular
+		if e, ok := files[filePath]; ok {
+			mode = e.Mode
+		}
+		files[filePath] = object.TreeEntry{Mode: mode, Hash: h}
+	}
+
+	// tree
+	treeHash, err := c.storeTreeFromFiles(c.r.Storer, files)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// commit
+	committer := ic.Committer
+	if committer.Name == "" && committer.Email == "" {
+		committer = ic.Author
+	}
+	commit := &object.Commit{
+		Author:       ic.Author,
+		Committer:    committer,
+		Message:      ic.Message,
+		TreeHash:     treeHash,
+		ParentHashes: parentHashes,
+	}
+	obj := c.r.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	hash, err = c.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	return hash, nil
+}
+
+// storeTreeFromFiles stores the nested trees of files, keyed by slash separated paths,
+// into s and returns the hash of the root tree.
+func (c *GitClient) storeTreeFromFiles(s storer.EncodedObjectStorer, files map[string]object.TreeEntry) (hash plumbing.Hash, err error) {
+	tree := &object.Tree{}
+	dirs := map[string]map[string]object.TreeEntry{}
+	for filePath, e := range files {
+		parts := strings.SplitN(filePath, "/", 2)
+		if len(parts) == 1 {
+			e.Name = filePath
+			tree.Entries = append(tree.Entries, e)
+			continue
+		}
+		if dirs[parts[0]] == nil {
+			dirs[parts[0]] = map[string]object.TreeEntry{}
+		}
+		dirs[parts[0]][parts[1]] = e
+	}
+	for name, dirFiles := range dirs {
+		h, err := c.storeTreeFromFiles(s, dirFiles)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+	return c.storeTree(s, tree)
+}
+
+// getIndexTree builds the tree of the index entries under prefix in a throwaway
+// storage, so the repo is not touched. If worktree is true, the content and modes of
+// the entries are read from the worktree instead, skipping the deleted files. It
+// returns a nil tree if there are no entries.
+func (c *GitClient) getIndexTree(prefix string, worktree bool) (tree *object.Tree, err error) {
+	// worktree
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// index
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// files
+	s := memory.NewStorage()
+	files := map[string]object.TreeEntry{}
+	for _, e := range idx.Entries {
+		// skip conflicted entries and files outside of prefix
+		if e.Stage != 0 || !isPathUnderPrefix(e.Name, prefix) {
+			continue
+		}
+
+		// index content
+		if !worktree {
+			obj, err := c.r.Storer.EncodedObject(plumbing.BlobObject, e.Hash)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			if _, err := s.SetEncodedObject(obj); err != nil {
+				return nil, trace.TraceError(err)
+			}
+			files[e.Name] = object.TreeEntry{Mode: e.Mode, Hash: e.Hash}
+			continue
+		}
+
+		// worktree content
+		fi, err := wt.Filesystem.Lstat(e.Name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		mode, err := filemode.NewFromOSFileMode(fi.Mode())
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		var data []byte
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := wt.Filesystem.Readlink(e.Name)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+			data = []byte(target)
+		} else {
+			data, err = util.ReadFile(wt.Filesystem, e.Name)
+			if err != nil {
+				return nil, trace.TraceError(err)
+			}
+		}
+		h, err := c.storeBlob(s, data)
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name] = object.TreeEntry{Mode: mode, Hash: h}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// tree
+	h, err := c.storeTreeFromFiles(s, files)
+	if err != nil {
+		return nil, err
+	}
+	tree, err = object.GetTree(s, h)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return tree, nil
+}
+
+// getTreesDiff returns the changed files under prefix between the trees, either of
+// which may be nil for an empty tree.
+func (c *GitClient) getTreesDiff(fromTree, toTree *object.Tree, prefix string) (files []GitDiffFile, err error) {
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	for _, change := range changes {
+		if !isPathUnderPrefix(change.From.Name, prefix) && !isPathUnderPrefix(change.To.Name, prefix) {
+			continue
+		}
+		f, err := getDiffFile(change)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (c *GitClient) storeBlob(s storer.EncodedObjectStorer, data []byte) (hash plumbing.Hash, err error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	hash, err = s.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	return hash, nil
+}
+
+// storeTree sorts the tree entries in git order, then stores the tree into s.
+func (c *GitClient) storeTree(s storer.EncodedObjectStorer, tree *object.Tree) (hash plumbing.Hash, err error) {
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return c.getTreeEntrySortName(tree.Entries[i]) < c.getTreeEntrySortName(tree.Entries[j])
+	})
+	obj := s.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	hash, err = s.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, trace.TraceError(err)
+	}
+	return hash, nil
+}
+
+func (c *GitClient) getTreeEntrySortName(e object.TreeEntry) (name string) {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+func (c *GitClient) getBlobContent(hash plumbing.Hash) (data []byte, err error) {
+	blob, err := c.r.BlobObject(hash)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer reader.Close()
+	data, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return data, nil
+}
+
+func (c *GitClient) getCommitFileContent(commit *object.Commit, filePath string) (data []byte, err error) {
+	// file
+	f, err := commit.File(filePath)
+	if err != nil {
+		if err == object.ErrFileNotFound {
+			return nil, trace.TraceError(ErrFileNotFoundInTree)
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	// content
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer reader.Close()
+	data, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	return data, nil
+}
+
+func (c *GitClient) getCommitByRef(ref string) (commit *object.Commit, err error) {
+	hash, err := c.r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	commit, err = c.r.CommitObject(*hash)
 	if err != nil {
-		return err
+		return nil, trace.TraceError(err)
 	}
+	return commit, nil
+}
 
-	// options
-	o := &git.CloneOptions{
-		URL:  c.remoteUrl,
-		Auth: auth,
+func (c *GitClient) setAutoCRLF(mode string) (err error) {
+	cfg, err := c.r.Config()
+	if err != nil {
+		return trace.TraceError(err)
 	}
-
-	// clone
-	if _, err := git.PlainClone(c.path, false, o); err != nil {
+	cfg.Raw.Section("core").SetOption("autocrlf", mode)
+	if err := c.r.SetConfig(cfg); err != nil {
 		return trace.TraceError(err)
 	}
-
 	return nil
 }
 
-func (c *GitClient) getInitType() (res GitInitType) {
-	if c.isMem {
-		return GitInitTypeMem
-	} else {
-		return GitInitTypeFs
+func (c *GitClient) getAutoCRLF() (mode string, err error) {
+	cfg, err := c.r.Config()
+	if err != nil {
+		return "", trace.TraceError(err)
 	}
+	return cfg.Raw.Section("core").Option("autocrlf"), nil
 }
 
-func (c *GitClient) createRemote(remoteName string, url string) (err error) {
-	_, err = c.r.CreateRemote(&config.RemoteConfig{
-		Name: remoteName,
-		URLs: []string{url},
-	})
+// validateIndexChanged returns git.ErrEmptyCommit if the entries of the index match
+// the files of the tree of HEAD. Unborn branches and conflicted indexes are not checked.
+func (c *GitClient) validateIndexChanged() (err error) {
+	// HEAD tree
+	headRef, err := c.r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	headCommit, err := c.r.CommitObject(headRef.Hash())
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	tree, err := headCommit.Tree()
 	if err != nil {
 		return trace.TraceError(err)
 	}
-	return
-}
 
-func (c *GitClient) getMemStorageAndMemFs(key string) (storage *memory.Storage, fs billy.Filesystem) {
-	// storage
-	storageItem, ok := GitMemStorages.Load(key)
-	if !ok {
-		storage = memory.NewStorage()
-		GitMemStorages.Store(key, storage)
-	} else {
-		switch storageItem.(type) {
-		case *memory.Storage:
-			storage = storageItem.(*memory.Storage)
-		default:
-			storage = memory.NewStorage()
-			GitMemStorages.Store(key, storage)
+	// index entries
+	idx, err := c.r.Storer.Index()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return nil
 		}
+		entries[e.Name] = e
 	}
 
-	// file system
-	fsItem, ok := GitMemFileSystem.Load(key)
-	if !ok {
-		fs = memfs.New()
-		GitMemFileSystem.Store(key, fs)
-	} else {
-		switch fsItem.(type) {
-		case billy.Filesystem:
-			fs = fsItem.(billy.Filesystem)
-		default:
-			fs = memfs.New()
-			GitMemFileSystem.Store(key, fs)
+	// compare with the files of the tree, stopping at the first difference
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	count := 0
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		e, ok := entries[name]
+		if !ok || e.Hash != entry.Hash || e.Mode != entry.Mode {
+			return nil
 		}
+		count++
+	}
+	if count != len(entries) {
+		return nil
 	}
 
-	return storage, fs
+	return trace.TraceError(git.ErrEmptyCommit)
 }
 
-func (c *GitClient) getGitAuth() (auth transport.AuthMethod, err error) {
-	switch c.authType {
-	case GitAuthTypeNone:
-		return nil, nil
-	case GitAuthTypeHTTP:
-		if c.username == "" && c.password == "" {
-			return nil, nil
-		}
-		auth = &http.BasicAuth{
-			Username: c.username,
-			Password: c.password,
-		}
-		return auth, nil
-	case GitAuthTypeSSH:
-		var privateKeyData []byte
-		if c.privateKey != "" {
-			// private key content
-			privateKeyData = []byte(c.privateKey)
-		} else if c.privateKeyPath != "" {
-			// read from private key file
-			privateKeyData, err = ioutil.ReadFile(c.privateKeyPath)
-			if err != nil {
-				return nil, trace.TraceError(err)
+// addModifiedAndDeleted stages modified and deleted tracked files, like the All
+// commit option of go-git.
+func (c *GitClient) addModifiedAndDeleted(wt *git.Worktree) (err error) {
+	status, err := wt.Status()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	for filePath, fileStatus := range status {
+		switch fileStatus.Worktree {
+		case git.Modified:
+			if _, err := wt.Add(filePath); err != nil {
+				return trace.TraceError(err)
+			}
+		case git.Deleted:
+			if _, err := wt.Remove(filePath); err != nil {
+				return trace.TraceError(err)
 			}
-		} else {
-			// no private key
-			return nil, nil
-		}
-		signer, err := ssh.ParsePrivateKey(privateKeyData)
-		if err != nil {
-			return nil, trace.TraceError(err)
-		}
-		auth = &gitssh.PublicKeys{
-			User:   c.username,
-			Signer: signer,
-			HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
-				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			},
 		}
-		return auth, nil
-	default:
-		return nil, trace.TraceError(ErrInvalidAuthType)
 	}
+	return nil
 }
 
-func (c *GitClient) getHeadRef() (ref string, err error) {
+// normalizeWorktreeLineEndings reopens the repo with its worktree filesystem wrapped
+// in a gitCRLFFilesystem, as go-git does not normalize line endings itself. Bare repos
+// have no worktree and are left as is.
+func (c *GitClient) normalizeWorktreeLineEndings() (err error) {
 	wt, err := c.r.Worktree()
+	if err == git.ErrIsBareRepository {
+		return nil
+	}
 	if err != nil {
-		return "", trace.TraceError(err)
+		return trace.TraceError(err)
+	}
+	c.r, err = git.Open(c.r.Storer, newGitCRLFFilesystem(wt.Filesystem))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+func (c *GitClient) renderCommitMessage(wt *git.Worktree, o *git.CommitOptions) (msg string, err error) {
+	if c.commitMessageTemplate == "" {
+		return "", trace.TraceError(ErrEmptyCommitMessage)
 	}
-	fh, err := wt.Filesystem.Open(path.Join(".git", "HEAD"))
+
+	// template
+	tmpl, err := template.New("commit").Parse(c.commitMessageTemplate)
 	if err != nil {
 		return "", trace.TraceError(err)
 	}
-	data, err := ioutil.ReadAll(fh)
+
+	// branch (empty if HEAD is detached)
+	branch, _ := c.GetCurrentBranch()
+
+	// file count
+	status, err := wt.Status()
 	if err != nil {
 		return "", trace.TraceError(err)
 	}
-	m := headRefRegexp.FindStringSubmatch(string(data))
-	if len(m) < 2 {
-		return "", trace.TraceError(ErrInvalidHeadRef)
+	fileCount := 0
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			fileCount++
+		} else if o.All && fileStatus.Worktree != git.Unmodified && fileStatus.Worktree != git.Untracked {
+			fileCount++
+		}
 	}
-	return m[1], nil
-}
 
-func (c *GitClient) getStatusString(statusCode git.StatusCode) (code string) {
-	return string(statusCode)
-	//switch statusCode {
-	//}
-	//Unmodified         StatusCode = ' '
-	//Untracked          StatusCode = '?'
-	//Modified           StatusCode = 'M'
-	//Added              StatusCode = 'A'
-	//Deleted            StatusCode = 'D'
-	//Renamed            StatusCode = 'R'
-	//Copied             StatusCode = 'C'
-	//UpdatedButUnmerged StatusCode = 'U'
+	// render
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, GitCommitMessageVars{
+		Branch:    branch,
+		FileCount: fileCount,
+		Timestamp: time.Now(),
+	}); err != nil {
+		return "", trace.TraceError(err)
+	}
+	msg = buf.String()
+	if msg == "" {
+		return "", trace.TraceError(ErrEmptyCommitMessage)
+	}
+
+	return msg, nil
 }
 
-func (c *GitClient) getDirPaths(filePath string) (paths []string) {
-	pathItems := strings.Split(filePath, "/")
+func (c *GitClient) isCommitTouchingPrefix(commit *object.Commit, prefix string) (ok bool, err error) {
+	// commit tree
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
 
-	var items []string
-	for i, pathItem := range pathItems {
-		if i == len(pathItems)-1 {
-			continue
+	// first parent tree (nil for root commits, diffing against an empty tree)
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return false, err
 		}
-		items = append(items, pathItem)
-		dirPath := strings.Join(items, "/")
-		paths = append(paths, dirPath)
 	}
 
-	return paths
+	// changes
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return false, err
+	}
+	for _, change := range changes {
+		if strings.HasPrefix(change.From.Name, prefix) || strings.HasPrefix(change.To.Name, prefix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
-func (c *GitClient) createBranch(branch, remote string, ref *plumbing.Reference) (err error) {
-	// create a new branch if it does not exist
-	cfg := config.Branch{
-		Name:   branch,
-		Remote: remote,
+func (c *GitClient) getTreeByRef(ref string) (tree *object.Tree, err error) {
+	if ref == "" {
+		return nil, nil
 	}
-	if err := c.r.CreateBranch(&cfg); err != nil {
-		return err
+	commit, err := c.getCommitByRef(ref)
+	if err != nil {
+		return nil, err
 	}
-	// if ref is nil
-	if ref == nil {
-		// try to set to remote ref of branch first
-		ref, err = c.getBranchHashRef(branch, remote)
+	tree, err = commit.Tree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return tree, nil
+}
 
-		// if no matched remote branch, set to HEAD
-		if err == ErrNoMatchedRemoteBranch {
-			ref, err = c.r.Head()
+func (c *GitClient) getReachableCommits(excludes ...plumbing.ReferenceName) (reachable map[plumbing.Hash]bool, err error) {
+	reachable = map[plumbing.Hash]bool{}
+	excluded := map[plumbing.ReferenceName]bool{}
+	for _, name := range excludes {
+		excluded[name] = true
+	}
+
+	// ref tips (HEAD included, tags peeled to commits)
+	var stack []plumbing.Hash
+	refs, err := c.r.References()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || excluded[ref.Name()] {
+			return nil
+		}
+		hash := ref.Hash()
+		if tag, err := c.r.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
 			if err != nil {
-				return trace.TraceError(err)
+				return nil
 			}
+			hash = commit.Hash
 		}
+		stack = append(stack, hash)
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if headRef, err := c.r.Head(); err == nil && !excluded[plumbing.HEAD] {
+		stack = append(stack, headRef.Hash())
+	}
 
-		// error
+	// walk parents
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[hash] {
+			continue
+		}
+		commit, err := c.r.CommitObject(hash)
 		if err != nil {
-			return trace.TraceError(err)
+			// not a commit or missing in shallow repos
+			continue
 		}
+		reachable[hash] = true
+		stack = append(stack, commit.ParentHashes...)
 	}
 
-	// branch reference name
-	branchRefName := plumbing.NewBranchReferenceName(branch)
-
-	// branch reference
-	branchRef := plumbing.NewHashReference(branchRefName, ref.Hash())
+	return reachable, nil
+}
 
-	// set HEAD to branch reference
-	if err := c.r.Storer.SetReference(branchRef); err != nil {
-		return err
+// getLogsBetween returns logs of commits reachable from "to" but not from "from".
+// A zero "from" hash returns the full history of "to".
+func (c *GitClient) getLogsBetween(from, to plumbing.Hash) (logs []GitLog, err error) {
+	// commits reachable from "from"
+	seen := map[plumbing.Hash]bool{}
+	if !from.IsZero() {
+		fromCommit, err := c.r.CommitObject(from)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		if err := object.NewCommitPreorderIter(fromCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+			seen[commit.Hash] = true
+			return nil
+		}); err != nil {
+			return nil, trace.TraceError(err)
+		}
 	}
 
-	return nil
-}
-
-func (c *GitClient) getBranchHashRef(branch, remote string) (hashRef *plumbing.Reference, err error) {
-	refs, err := c.GetRemoteRefs(remote)
+	// walk "to" skipping commits already reachable from "from"
+	toCommit, err := c.r.CommitObject(to)
 	if err != nil {
-		return nil, err
-	}
-	var branchRef *GitRef
-	for _, r := range refs {
-		if r.Name == branch {
-			branchRef = &r
-			break
-		}
+		return nil, trace.TraceError(err)
 	}
-	if branchRef == nil {
-		return nil, ErrNoMatchedRemoteBranch
+	if err := object.NewCommitPreorderIter(toCommit, seen, nil).ForEach(func(commit *object.Commit) error {
+		logs = append(logs, c.getGitLog(commit))
+		return nil
+	}); err != nil {
+		return nil, trace.TraceError(err)
 	}
-	branchHashRef := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), plumbing.NewHash(branchRef.Hash))
-	return branchHashRef, nil
+
+	return logs, nil
 }
 
 func (c *GitClient) isRemoteChanged() (ok bool, err error) {
@@ -999,10 +5688,14 @@ func (c *GitClient) isRemoteChanged() (ok bool, err error) {
 func NewGitClient(opts ...GitOption) (c *GitClient, err error) {
 	// client
 	c = &GitClient{
-		isMem:          false,
-		authType:       GitAuthTypeNone,
-		username:       "git",
-		privateKeyPath: getDefaultPublicKeyPath(),
+		isMem:           false,
+		authType:        GitAuthTypeNone,
+		username:        "git",
+		privateKeyPath:  getDefaultPublicKeyPath(),
+		repoFileMode:    GitDefaultRepoFileMode,
+		repoDirMode:     GitDefaultRepoDirMode,
+		defaultFileMode: GitDefaultFileMode,
+		followRedirects: true,
 	}
 
 	// apply options
@@ -1010,6 +5703,12 @@ func NewGitClient(opts ...GitOption) (c *GitClient, err error) {
 		opt(c)
 	}
 
+	// http client of the client
+	if !c.followRedirects {
+		c.httpTransport = newNoFollowHttpTransport()
+		installGitHttpTransports()
+	}
+
 	// init
 	if err := c.Init(); err != nil {
 		return c, err
@@ -0,0 +1,62 @@
+package vcs
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/crawlab-team/go-trace"
+)
+
+// Most operations are implemented in pure Go with go-git. The few relying on the
+// git binary (currently GC) share the path configured here, and return
+// ErrGitBinaryNotFound if no binary is available.
+var gitBinaryPath string
+
+// SetGitBinaryPath sets the git binary used by operations shelling out to git. An
+// empty path looks up "git" in PATH.
+func SetGitBinaryPath(path string) {
+	gitBinaryPath = path
+}
+
+// GetGitBinaryPath returns the configured git binary, or the one found in PATH.
+func GetGitBinaryPath() (path string, err error) {
+	if gitBinaryPath == "" {
+		path, err = exec.LookPath("git")
+		if err != nil {
+			return "", trace.TraceError(ErrGitBinaryNotFound)
+		}
+		return path, nil
+	}
+	info, err := os.Stat(gitBinaryPath)
+	if err != nil || info.IsDir() {
+		return "", trace.TraceError(ErrGitBinaryNotFound)
+	}
+	return gitBinaryPath, nil
+}
+
+// runGit runs the git binary with args in the repo directory (fs repos only).
+func (c *GitClient) runGit(args ...string) (out []byte, err error) {
+	if c.isMem {
+		return nil, trace.TraceError(ErrNotFsRepo)
+	}
+	bin, err := GetGitBinaryPath()
+	if err != nil {
+		return nil, err
+	}
+	dir := c.realPath
+	if dir == "" {
+		dir = c.path
+	}
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return out, trace.TraceError(errors.New(msg))
+		}
+		return out, trace.TraceError(err)
+	}
+	return out, nil
+}
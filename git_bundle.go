@@ -0,0 +1,87 @@
+package vcs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// go-git has no bundle support, so the v2 format is implemented here:
+//
+//	# v2 git bundle
+//	-<hash> <comment>    (prerequisites, not written nor supported)
+//	<hash> <refname>
+//	<empty line>
+//	<packfile>
+const gitBundleSignatureV2 = "# v2 git bundle"
+
+// gitBundlePackWindow is the delta window used to encode the bundle packfile.
+const gitBundlePackWindow = 10
+
+func writeGitBundle(w io.Writer, s storer.EncodedObjectStorer, refs []*plumbing.Reference) (err error) {
+	bw := bufio.NewWriter(w)
+
+	// header
+	if _, err := fmt.Fprintln(bw, gitBundleSignatureV2); err != nil {
+		return err
+	}
+	var tips []plumbing.Hash
+	for _, ref := range refs {
+		if _, err := fmt.Fprintf(bw, "%s %s\n", ref.Hash(), ref.Name()); err != nil {
+			return err
+		}
+		tips = append(tips, ref.Hash())
+	}
+	if _, err := fmt.Fprintln(bw); err != nil {
+		return err
+	}
+
+	// packfile of all objects reachable from the ref tips
+	hashes, err := revlist.Objects(s, tips, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := packfile.NewEncoder(bw, s, false).Encode(hashes, gitBundlePackWindow); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// readGitBundleHeader reads the header of a v2 bundle, leaving r at the start of
+// the packfile.
+func readGitBundleHeader(r *bufio.Reader) (refs []*plumbing.Reference, err error) {
+	// signature
+	line, err := r.ReadString('\n')
+	if err != nil || strings.TrimSuffix(line, "\n") != gitBundleSignatureV2 {
+		return nil, ErrInvalidBundle
+	}
+
+	// refs
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, ErrInvalidBundle
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "-") {
+			return nil, ErrBundlePrerequisites
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || len(parts[0]) != 40 {
+			return nil, ErrInvalidBundle
+		}
+		refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(parts[1]), plumbing.NewHash(parts[0])))
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,51 @@
+package vcs
+
+import (
+	"sync/atomic"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// gitObjectCacheStorage keeps recently read encoded objects of a client in an
+// lru cache so that repeated log and diff walks skip the object lookups of the
+// underlying storage. The embedded storage keeps the optional storer interfaces
+// (packfile writer, loose objects) available to go-git.
+type gitObjectCacheStorage struct {
+	*filesystem.Storage
+	cache  cache.Object
+	hits   int64
+	misses int64
+}
+
+func newGitObjectCacheStorage(s *filesystem.Storage, size cache.FileSize) *gitObjectCacheStorage {
+	return &gitObjectCacheStorage{
+		Storage: s,
+		cache:   cache.NewObjectLRU(size),
+	}
+}
+
+func (s *gitObjectCacheStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if obj, ok := s.cache.Get(h); ok {
+		if t != plumbing.AnyObject && obj.Type() != t {
+			return nil, plumbing.ErrObjectNotFound
+		}
+		atomic.AddInt64(&s.hits, 1)
+		return obj, nil
+	}
+	atomic.AddInt64(&s.misses, 1)
+	obj, err := s.Storage.EncodedObject(t, h)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Put(obj)
+	return obj, nil
+}
+
+func (s *gitObjectCacheStorage) getStats() GitObjectCacheStats {
+	return GitObjectCacheStats{
+		Hits:   atomic.LoadInt64(&s.hits),
+		Misses: atomic.LoadInt64(&s.misses),
+	}
+}
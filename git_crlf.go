@@ -0,0 +1,191 @@
+package vcs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// gitCRLFFilesystem wraps the worktree filesystem of a client with core.autocrlf
+// enabled so that text files read by go-git have CRLF line endings converted to LF.
+// go-git hashes, stages and compares worktree files through this filesystem, so
+// the index, the status and commits all see the normalized content, while the files
+// on disk keep their CRLF line endings. Sizes reported by Stat, Lstat and ReadDir
+// match the normalized content, as go-git hashes files with them; they are counted
+// by streaming the file and cached by name, modification time and size. Writes are
+// not converted, as go-git does not support converting LF back to CRLF on checkout.
+type gitCRLFFilesystem struct {
+	billy.Filesystem
+	mu    sync.Mutex
+	sizes map[gitCRLFSizeKey]int64
+}
+
+// gitCRLFSizeKey identifies a version of a file whose normalized size is cached.
+type gitCRLFSizeKey struct {
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+func newGitCRLFFilesystem(fs billy.Filesystem) *gitCRLFFilesystem {
+	return &gitCRLFFilesystem{Filesystem: fs, sizes: map[gitCRLFSizeKey]int64{}}
+}
+
+func (fs *gitCRLFFilesystem) Open(filename string) (billy.File, error) {
+	return fs.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (fs *gitCRLFFilesystem) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	f, err := fs.Filesystem.OpenFile(filename, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return f, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	data, _ = normalizeCRLF(data)
+	return &gitCRLFFile{File: f, reader: bytes.NewReader(data)}, nil
+}
+
+func (fs *gitCRLFFilesystem) Stat(filename string) (os.FileInfo, error) {
+	fi, err := fs.Filesystem.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return fs.getFileInfo(filename, fi)
+}
+
+func (fs *gitCRLFFilesystem) Lstat(filename string) (os.FileInfo, error) {
+	fi, err := fs.Filesystem.Lstat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return fs.getFileInfo(filename, fi)
+}
+
+func (fs *gitCRLFFilesystem) ReadDir(path string) ([]os.FileInfo, error) {
+	infos, err := fs.Filesystem.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, fi := range infos {
+		infos[i], err = fs.getFileInfo(fs.Join(path, fi.Name()), fi)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (fs *gitCRLFFilesystem) Chroot(path string) (billy.Filesystem, error) {
+	sub, err := fs.Filesystem.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+	return newGitCRLFFilesystem(sub), nil
+}
+
+// getFileInfo returns fi with the size of the normalized content if the regular file
+// filename has CRLF line endings.
+func (fs *gitCRLFFilesystem) getFileInfo(filename string, fi os.FileInfo) (os.FileInfo, error) {
+	if !fi.Mode().IsRegular() {
+		return fi, nil
+	}
+
+	// cached
+	key := gitCRLFSizeKey{name: filename, modTime: fi.ModTime(), size: fi.Size()}
+	fs.mu.Lock()
+	size, ok := fs.sizes[key]
+	fs.mu.Unlock()
+
+	// count
+	if !ok {
+		count, err := fs.countCRLF(filename)
+		if err != nil {
+			return nil, err
+		}
+		size = fi.Size() - count
+		fs.mu.Lock()
+		fs.sizes[key] = size
+		fs.mu.Unlock()
+	}
+
+	if size == fi.Size() {
+		return fi, nil
+	}
+	return &gitCRLFFileInfo{FileInfo: fi, size: size}, nil
+}
+
+// countCRLF streams filename and counts its CRLF pairs, returning zero for content with
+// a null byte, which is taken as binary and not normalized.
+func (fs *gitCRLFFilesystem) countCRLF(filename string) (count int64, err error) {
+	f, err := fs.Filesystem.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	cr := false
+	for {
+		n, err := f.Read(buf)
+		for _, b := range buf[:n] {
+			switch {
+			case b == 0:
+				return 0, nil
+			case b == '\n' && cr:
+				count++
+			}
+			cr = b == '\r'
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// gitCRLFFile serves the normalized content of a file opened for reading.
+type gitCRLFFile struct {
+	billy.File
+	reader *bytes.Reader
+}
+
+func (f *gitCRLFFile) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
+
+func (f *gitCRLFFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.reader.ReadAt(p, off)
+}
+
+func (f *gitCRLFFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+
+type gitCRLFFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *gitCRLFFileInfo) Size() int64 {
+	return fi.size
+}
+
+// normalizeCRLF replaces CRLF with LF in text content, content with a null byte being
+// taken as binary and left as is. It reports whether data was changed.
+func normalizeCRLF(data []byte) ([]byte, bool) {
+	if bytes.IndexByte(data, 0) >= 0 || !bytes.Contains(data, []byte("\r\n")) {
+		return data, false
+	}
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), true
+}
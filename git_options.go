@@ -1,12 +1,16 @@
 package vcs
 
 import (
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"os"
 	"strings"
+	"time"
 )
 
 type GitOption func(c *GitClient)
@@ -23,6 +27,12 @@ func WithRemoteUrl(url string) GitOption {
 	}
 }
 
+func WithNoAutoRemote(noAutoRemote bool) GitOption {
+	return func(c *GitClient) {
+		c.noAutoRemote = noAutoRemote
+	}
+}
+
 func WithIsMem() GitOption {
 	return func(c *GitClient) {
 		c.isMem = true
@@ -65,6 +75,173 @@ func WithPrivateKeyPath(path string) GitOption {
 	}
 }
 
+func WithFollowRedirects(follow bool) GitOption {
+	return func(c *GitClient) {
+		c.followRedirects = follow
+	}
+}
+
+// WithAutoCRLF writes core.autocrlf to the repo config. With GitAutoCRLFTrue or
+// GitAutoCRLFInput, CRLF line endings of text files are converted to LF when staged,
+// while the worktree files keep them and are not reported as modified.
+func WithAutoCRLF(mode string) GitOption {
+	return func(c *GitClient) {
+		c.autoCRLF = mode
+	}
+}
+
+// WithObjectCache keeps up to size bytes of recently read objects in a per-client
+// lru cache, which speeds up repeated log and diff walks of fs repos.
+func WithObjectCache(size cache.FileSize) GitOption {
+	return func(c *GitClient) {
+		c.objectCacheSize = size
+	}
+}
+
+// WithFollowSymlinks controls Dispose when the repo path is a symlink. By default
+// only the link is removed and its target is kept; with follow set to true the
+// target directory is removed as well.
+func WithFollowSymlinks(follow bool) GitOption {
+	return func(c *GitClient) {
+		c.followSymlinks = follow
+	}
+}
+
+// WithMailmap canonicalizes author identities in logs without rewriting history.
+// Keys are commit emails (case-insensitive), values are either an email or a
+// "Proper Name <proper@email>" identity, like the entries of a .mailmap file.
+func WithMailmap(mapping map[string]string) GitOption {
+	return func(c *GitClient) {
+		c.mailmap = map[string]string{}
+		for email, identity := range mapping {
+			c.mailmap[strings.ToLower(email)] = identity
+		}
+	}
+}
+
+// WithTrustedPath skips CheckOwnership for the repo at path, like git's
+// safe.directory. "*" trusts every path.
+func WithTrustedPath(path string) GitOption {
+	return func(c *GitClient) {
+		c.trustedPaths = append(c.trustedPaths, path)
+	}
+}
+
+// WithOwnerUid makes CheckOwnership expect the repo to be owned by uid instead of
+// the effective uid of the process, e.g. for a service managing repos of another
+// user.
+func WithOwnerUid(uid int) GitOption {
+	return func(c *GitClient) {
+		c.ownerUid = &uid
+	}
+}
+
+// WithDisableHooks removes the hooks of the repo on Init (see RemoveHooks), for
+// running untrusted repos.
+func WithDisableHooks(disable bool) GitOption {
+	return func(c *GitClient) {
+		c.disableHooks = disable
+	}
+}
+
+// WithDisposeRetry retries the removal of fs repos in Dispose up to attempts times,
+// waiting delay in between, e.g. while files are still in use on windows.
+func WithDisposeRetry(attempts int, delay time.Duration) GitOption {
+	return func(c *GitClient) {
+		c.disposeRetryAttempts = attempts
+		c.disposeRetryDelay = delay
+	}
+}
+
+// WithNoNestedRepo makes Init fail with ErrNestedRepo instead of creating a new
+// repo inside the worktree of an existing one.
+func WithNoNestedRepo(noNested bool) GitOption {
+	return func(c *GitClient) {
+		c.noNestedRepo = noNested
+	}
+}
+
+// WithNoCreate makes Init fail with ErrRepoPathNotExists if the repo directory does
+// not exist, instead of creating it, for callers expecting an existing repo.
+func WithNoCreate(noCreate bool) GitOption {
+	return func(c *GitClient) {
+		c.noCreate = noCreate
+	}
+}
+
+// WithRemoteFetchRefSpecs sets the fetch refspecs of the origin remote created at
+// init, replacing the default one, so later fetches and pulls use them as well.
+func WithRemoteFetchRefSpecs(specs []config.RefSpec) GitOption {
+	return func(c *GitClient) {
+		c.remoteFetchRefSpecs = specs
+	}
+}
+
+// WithHTTPHeaders sets static headers on every http request to the remote, e.g. an
+// api key required by a gateway in addition to basic auth.
+func WithHTTPHeaders(headers map[string]string) GitOption {
+	return func(c *GitClient) {
+		c.httpHeaders = headers
+	}
+}
+
+// WithSignKeyFile signs commits with the armored private key in the file at path,
+// decrypted with passphrase. The key is read once by Init, which fails if the key
+// file or the passphrase is invalid.
+func WithSignKeyFile(path, passphrase string) GitOption {
+	return func(c *GitClient) {
+		c.signKeyPath = path
+		c.signKeyPassphrase = passphrase
+	}
+}
+
+// WithSignKeyBytes signs commits with the armored private key, decrypted with
+// passphrase. The key is parsed once by Init, which fails if the key or the
+// passphrase is invalid.
+func WithSignKeyBytes(key []byte, passphrase string) GitOption {
+	return func(c *GitClient) {
+		c.signKey = key
+		c.signKeyPassphrase = passphrase
+	}
+}
+
+// WithCommitMessageTemplate sets a text/template rendered with GitCommitMessageVars
+// when Commit or CommitAll is given an empty message.
+func WithCommitMessageTemplate(tmpl string) GitOption {
+	return func(c *GitClient) {
+		c.commitMessageTemplate = tmpl
+	}
+}
+
+func WithRepoPermissions(fileMode, dirMode os.FileMode) GitOption {
+	return func(c *GitClient) {
+		c.repoFileMode = fileMode
+		c.repoDirMode = dirMode
+	}
+}
+
+// WithDefaultFileMode sets the mode of worktree files created by helpers such as
+// RestoreFile, WriteMemFile and ResolveConflict (GitDefaultFileMode by default).
+func WithDefaultFileMode(mode os.FileMode) GitOption {
+	return func(c *GitClient) {
+		c.defaultFileMode = mode
+	}
+}
+
+func WithLogger(logger GitLogger) GitOption {
+	return func(c *GitClient) {
+		c.logger = logger
+	}
+}
+
+// WithMetrics records the count, duration and errors of the main operations, named
+// e.g. "init", "commit", "pull" or "checkout_branch", with m.
+func WithMetrics(m GitMetricsRecorder) GitOption {
+	return func(c *GitClient) {
+		c.metrics = m
+	}
+}
+
 type GitCloneOption func(o *git.CloneOptions)
 
 func WithURL(url string) GitCloneOption {
@@ -115,10 +292,27 @@ func WithTags(tags git.TagMode) GitCloneOption {
 	}
 }
 
-type GitCheckoutOption func(o *git.CheckoutOptions)
+func WithProgressClone(handler GitProgressHandler) GitCloneOption {
+	return func(o *git.CloneOptions) {
+		o.Progress = newGitProgressWriter(handler)
+	}
+}
+
+// GitCheckoutOption sets GitCheckoutOptions, which embeds git.CheckoutOptions with
+// the settings go-git does not support. It took *git.CheckoutOptions before KeepHead
+// was added; such options can be passed through WithCheckoutOptions.
+type GitCheckoutOption func(o *GitCheckoutOptions)
+
+// WithCheckoutOptions adapts an option setting git.CheckoutOptions directly, as
+// GitCheckoutOption did before it took GitCheckoutOptions.
+func WithCheckoutOptions(opt func(o *git.CheckoutOptions)) GitCheckoutOption {
+	return func(o *GitCheckoutOptions) {
+		opt(&o.CheckoutOptions)
+	}
+}
 
 func WithBranch(branch string) GitCheckoutOption {
-	return func(o *git.CheckoutOptions) {
+	return func(o *GitCheckoutOptions) {
 		if strings.HasPrefix(branch, "refs/heads") {
 			o.Branch = plumbing.ReferenceName(branch)
 		} else {
@@ -128,7 +322,7 @@ func WithBranch(branch string) GitCheckoutOption {
 }
 
 func WithHash(hash string) GitCheckoutOption {
-	return func(o *git.CheckoutOptions) {
+	return func(o *GitCheckoutOptions) {
 		h := plumbing.NewHash(hash)
 		if h.IsZero() {
 			return
@@ -137,54 +331,155 @@ func WithHash(hash string) GitCheckoutOption {
 	}
 }
 
-type GitCommitOption func(o *git.CommitOptions)
+// WithForceCheckout discards local changes to tracked files that would block the
+// checkout. This is destructive: the discarded edits cannot be recovered.
+func WithForceCheckout(force bool) GitCheckoutOption {
+	return func(o *GitCheckoutOptions) {
+		o.Force = force
+	}
+}
+
+// WithKeepHead updates the worktree and index to the checkout target but leaves
+// HEAD (and the branch it points to) where it is, like "git checkout <ref> -- .".
+// The target's files then show up as staged changes against HEAD. Without it,
+// checking out a hash detaches HEAD and checking out a branch moves HEAD to it.
+func WithKeepHead(keep bool) GitCheckoutOption {
+	return func(o *GitCheckoutOptions) {
+		o.KeepHead = keep
+	}
+}
+
+type GitLogOption func(o *git.LogOptions)
+
+func WithFromLog(hash string) GitLogOption {
+	return func(o *git.LogOptions) {
+		o.From = plumbing.NewHash(hash)
+	}
+}
+
+func WithAllLog(all bool) GitLogOption {
+	return func(o *git.LogOptions) {
+		o.All = all
+	}
+}
+
+func WithSinceLog(since time.Time) GitLogOption {
+	return func(o *git.LogOptions) {
+		o.Since = &since
+	}
+}
+
+func WithUntilLog(until time.Time) GitLogOption {
+	return func(o *git.LogOptions) {
+		o.Until = &until
+	}
+}
+
+// GitCommitOption sets GitCommitOptions, which embeds git.CommitOptions with the
+// settings go-git does not support. It took *git.CommitOptions before Atomic was
+// added; such options can be passed through WithCommitOptions.
+type GitCommitOption func(o *GitCommitOptions)
+
+// WithCommitOptions adapts an option setting git.CommitOptions directly, as
+// GitCommitOption did before it took GitCommitOptions.
+func WithCommitOptions(opt func(o *git.CommitOptions)) GitCommitOption {
+	return func(o *GitCommitOptions) {
+		opt(&o.CommitOptions)
+	}
+}
 
 func WithAll(all bool) GitCommitOption {
-	return func(o *git.CommitOptions) {
+	return func(o *GitCommitOptions) {
 		o.All = all
 	}
 }
 
 func WithAuthor(author *object.Signature) GitCommitOption {
-	return func(o *git.CommitOptions) {
+	return func(o *GitCommitOptions) {
 		o.Author = author
 	}
 }
 
 func WithCommitter(committer *object.Signature) GitCommitOption {
-	return func(o *git.CommitOptions) {
+	return func(o *GitCommitOptions) {
 		o.Committer = committer
 	}
 }
 
+func WithCommitterIdentity(name, email string) GitCommitOption {
+	return func(o *GitCommitOptions) {
+		o.Committer = &object.Signature{
+			Name:  name,
+			Email: email,
+			When:  time.Now(),
+		}
+	}
+}
+
+func WithSignKey(signKey *openpgp.Entity) GitCommitOption {
+	return func(o *GitCommitOptions) {
+		o.SignKey = signKey
+	}
+}
+
 func WithParents(parents []plumbing.Hash) GitCommitOption {
-	return func(o *git.CommitOptions) {
+	return func(o *GitCommitOptions) {
 		o.Parents = parents
 	}
 }
 
-type GitPullOption func(o *git.PullOptions)
+// WithAllowEmpty lets Commit create a commit that does not change the tree of its
+// parent, e.g. to mark a deploy point. Without it such commits fail with
+// git.ErrEmptyCommit. This is a behavior change: go-git, and this package before
+// WithAllowEmpty was added, committed an unchanged tree without error, so callers
+// relying on that must now pass WithAllowEmpty(true).
+func WithAllowEmpty(allow bool) GitCommitOption {
+	return func(o *GitCommitOptions) {
+		o.AllowEmptyCommits = allow
+	}
+}
+
+// WithAtomic restores the index staged by CommitAll if the commit fails, so a
+// rejected commit does not leave the repo half-staged.
+func WithAtomic(atomic bool) GitCommitOption {
+	return func(o *GitCommitOptions) {
+		o.Atomic = atomic
+	}
+}
+
+// GitPullOption sets GitPullOptions, which embeds git.PullOptions with the settings
+// go-git does not support. It took *git.PullOptions before Tags was added; such
+// options can be passed through WithPullOptions.
+type GitPullOption func(o *GitPullOptions)
+
+// WithPullOptions adapts an option setting git.PullOptions directly, as GitPullOption
+// did before it took GitPullOptions.
+func WithPullOptions(opt func(o *git.PullOptions)) GitPullOption {
+	return func(o *GitPullOptions) {
+		opt(&o.PullOptions)
+	}
+}
 
 func WithRemoteNamePull(name string) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		o.RemoteName = name
 	}
 }
 
 func WithBranchNamePull(branch string) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		o.ReferenceName = plumbing.NewBranchReferenceName(branch)
 	}
 }
 
 func WithDepthPull(depth int) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		o.Depth = depth
 	}
 }
 
 func WithAuthPull(auth transport.AuthMethod) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		if auth != nil {
 			o.Auth = auth
 		}
@@ -192,17 +487,118 @@ func WithAuthPull(auth transport.AuthMethod) GitPullOption {
 }
 
 func WithRecurseSubmodulesPull(recurseSubmodules git.SubmoduleRescursivity) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		o.RecurseSubmodules = recurseSubmodules
 	}
 }
 
 func WithForcePull(force bool) GitPullOption {
-	return func(o *git.PullOptions) {
+	return func(o *GitPullOptions) {
 		o.Force = force
 	}
 }
 
+func WithTagsPull(tags git.TagMode) GitPullOption {
+	return func(o *GitPullOptions) {
+		o.Tags = tags
+	}
+}
+
+// WithConflictStrategy makes Pull merge a diverged remote branch instead of leaving
+// it unmerged. Text files changed on both sides are merged line by line, like git:
+// changes to different lines of both sides are kept, and only conflicting hunks,
+// whose changes overlap or are adjacent, take the given side (GitConflictStrategyOurs
+// or GitConflictStrategyTheirs). So a conflicted file is not replaced by the given
+// side as a whole; only binary files, symlinks and files deleted on one side and
+// changed on the other are.
+func WithConflictStrategy(strategy string) GitPullOption {
+	return func(o *GitPullOptions) {
+		o.ConflictStrategy = strategy
+	}
+}
+
+func WithProgressPull(handler GitProgressHandler) GitPullOption {
+	return func(o *GitPullOptions) {
+		o.Progress = newGitProgressWriter(handler)
+	}
+}
+
+type GitFetchOption func(o *GitFetchOptions)
+
+func WithRemoteNameFetch(name string) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.RemoteName = name
+	}
+}
+
+// WithRemoteURLFetch fetches from url instead of the url of the remote, whose
+// refspecs still apply.
+func WithRemoteURLFetch(url string) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.RemoteURL = url
+	}
+}
+
+func WithDepthFetch(depth int) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.Depth = depth
+	}
+}
+
+func WithAuthFetch(auth transport.AuthMethod) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		if auth != nil {
+			o.Auth = auth
+		}
+	}
+}
+
+func WithForceFetch(force bool) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.Force = force
+	}
+}
+
+// WithFetchRefSpecs fetches refs outside the remote's configured refspecs, e.g.
+// "+refs/pull/*/head:refs/remotes/origin/pr/*" for pull request refs.
+func WithFetchRefSpecs(specs []config.RefSpec) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.RefSpecs = specs
+	}
+}
+
+// WithFetchCommit fetches only the commit hash and its history into FETCH_HEAD, to
+// be checked out detached with CheckoutHash. The server must allow any (or reachable)
+// sha1 in wants (uploadpack.allowAnySHA1InWant), otherwise Fetch returns
+// ErrFetchCommitNotSupported.
+func WithFetchCommit(hash string) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.RefSpecs = append(o.RefSpecs, config.RefSpec("+"+hash+":"+GitFetchHead))
+	}
+}
+
+func WithTagsFetch(tags git.TagMode) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.Tags = tags
+	}
+}
+
+// WithShallowSince fetches only commits newer than since (git fetch --shallow-since).
+// It requires the server to advertise the "deepen-since" capability, which git's own
+// upload-pack does (including local file remotes); for servers that do not, the fetch
+// falls back to a normal fetch limited by WithDepthFetch, if given.
+func WithShallowSince(since time.Time) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.ShallowSince = since
+	}
+}
+
+func WithProgressFetch(handler GitProgressHandler) GitFetchOption {
+	return func(o *GitFetchOptions) {
+		o.Progress = newGitProgressWriter(handler)
+	}
+}
+
 type GitPushOption func(o *git.PushOptions)
 
 func WithRemoteNamePush(name string) GitPushOption {
@@ -211,6 +607,13 @@ func WithRemoteNamePush(name string) GitPushOption {
 	}
 }
 
+// WithRemoteURLPush pushes to url instead of the url of the remote.
+func WithRemoteURLPush(url string) GitPushOption {
+	return func(o *git.PushOptions) {
+		o.RemoteURL = url
+	}
+}
+
 func WithRefSpecs(specs []config.RefSpec) GitPushOption {
 	return func(o *git.PushOptions) {
 		o.RefSpecs = specs
@@ -235,6 +638,38 @@ func WithForcePush(force bool) GitPushOption {
 	}
 }
 
+type GitRewordOption func(o *GitRewordOptions)
+
+// WithForceReword allows RewordCommit to rewrite commits already pushed to a remote.
+func WithForceReword(force bool) GitRewordOption {
+	return func(o *GitRewordOptions) {
+		o.Force = force
+	}
+}
+
+type GitTagListOption func(o *GitTagListOptions)
+
+func WithLimitTagList(limit int) GitTagListOption {
+	return func(o *GitTagListOptions) {
+		o.Limit = limit
+	}
+}
+
+func WithSkipTagList(skip int) GitTagListOption {
+	return func(o *GitTagListOptions) {
+		o.Skip = skip
+	}
+}
+
+type GitTagCreateOption func(o *GitTagCreateOptions)
+
+// WithAtomicTagCreate makes CreateTags create either all the tags or none of them.
+func WithAtomicTagCreate(atomic bool) GitTagCreateOption {
+	return func(o *GitTagCreateOptions) {
+		o.Atomic = atomic
+	}
+}
+
 type GitResetOption func(o *git.ResetOptions)
 
 func WithCommit(commit plumbing.Hash) GitResetOption {
@@ -248,3 +683,23 @@ func WithMode(mode git.ResetMode) GitResetOption {
 		o.Mode = mode
 	}
 }
+
+type GitSubmoduleUpdateOption func(o *git.SubmoduleUpdateOptions)
+
+func WithSubmoduleDepth(depth int) GitSubmoduleUpdateOption {
+	return func(o *git.SubmoduleUpdateOptions) {
+		o.Depth = depth
+	}
+}
+
+func WithRecurseSubmodulesUpdate(recurseSubmodules git.SubmoduleRescursivity) GitSubmoduleUpdateOption {
+	return func(o *git.SubmoduleUpdateOptions) {
+		o.RecurseSubmodules = recurseSubmodules
+	}
+}
+
+func WithAuthSubmodule(auth transport.AuthMethod) GitSubmoduleUpdateOption {
+	return func(o *git.SubmoduleUpdateOptions) {
+		o.Auth = auth
+	}
+}
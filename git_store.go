@@ -4,3 +4,13 @@ import "sync"
 
 var GitMemStorages = sync.Map{}
 var GitMemFileSystem = sync.Map{}
+
+// gitInitLocks serializes Init of clients sharing the same repo path.
+var gitInitLocks = sync.Map{}
+
+func lockInit(key string) (unlock func()) {
+	v, _ := gitInitLocks.LoadOrStore(key, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
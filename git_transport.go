@@ -0,0 +1,158 @@
+package vcs
+
+import (
+	nethttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// gitHttpTransports delegates the http sessions of clients with their own http
+// client to it and all other sessions, e.g. of programs using go-git directly, to
+// the transport registered before. go-git v5 resolves transports from a global
+// registry only, with no way to pass an http client to fetch, push or clone, so
+// it is installed on first need (a client not following redirects) rather than
+// at package init, and leaves the traffic of everything else unchanged.
+var gitHttpTransports struct {
+	once sync.Once
+}
+
+func installGitHttpTransports() {
+	gitHttpTransports.once.Do(func() {
+		for _, scheme := range []string{"http", "https"} {
+			client.InstallProtocol(scheme, &gitHttpTransport{base: client.Protocols[scheme]})
+		}
+	})
+}
+
+// gitHttpAuth carries the per-client http settings to the transport: the http
+// client transport (nil for go-git's default) and static headers.
+type gitHttpAuth struct {
+	auth      http.AuthMethod
+	transport transport.Transport
+	headers   map[string]string
+}
+
+// SetAuth applies the wrapped auth and the static headers to every request. The
+// header values are never part of String, so they do not leak into logs.
+func (a *gitHttpAuth) SetAuth(r *nethttp.Request) {
+	if a.auth != nil {
+		a.auth.SetAuth(r)
+	}
+	for k, v := range a.headers {
+		r.Header.Set(k, v)
+	}
+}
+
+func (a *gitHttpAuth) Name() string {
+	if a.auth == nil {
+		return "http-none"
+	}
+	return a.auth.Name()
+}
+
+func (a *gitHttpAuth) String() string {
+	if a.auth == nil {
+		return a.Name()
+	}
+	return a.auth.String()
+}
+
+type gitHttpTransport struct {
+	base transport.Transport
+}
+
+func (t *gitHttpTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	tr, auth := t.resolve(auth)
+	return tr.NewUploadPackSession(ep, auth)
+}
+
+func (t *gitHttpTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	tr, auth := t.resolve(auth)
+	return tr.NewReceivePackSession(ep, auth)
+}
+
+func (t *gitHttpTransport) resolve(auth transport.AuthMethod) (transport.Transport, transport.AuthMethod) {
+	a, ok := auth.(*gitHttpAuth)
+	if !ok || a.transport == nil {
+		return t.base, auth
+	}
+	if len(a.headers) > 0 {
+		return a.transport, a
+	}
+	if a.auth == nil {
+		return a.transport, nil
+	}
+	return a.transport, a.auth
+}
+
+// newNoFollowHttpTransport returns an http transport whose client refuses redirects.
+func newNoFollowHttpTransport() transport.Transport {
+	return http.NewClient(&nethttp.Client{CheckRedirect: noFollowRedirect})
+}
+
+func noFollowRedirect(req *nethttp.Request, via []*nethttp.Request) error {
+	return ErrHttpRedirectNotAllowed
+}
+
+func isHttpUrl(rawUrl string) bool {
+	return strings.HasPrefix(rawUrl, "http://") || strings.HasPrefix(rawUrl, "https://")
+}
+
+var sshHostSemaphores = struct {
+	sync.Mutex
+	max int
+	m   map[string]chan struct{}
+}{m: map[string]chan struct{}{}}
+
+// SetSSHMaxConnectionsPerHost caps concurrent ssh connections of Pull, Push and Fetch
+// to the same host. Zero or less means no limit.
+func SetSSHMaxConnectionsPerHost(max int) {
+	sshHostSemaphores.Lock()
+	defer sshHostSemaphores.Unlock()
+	sshHostSemaphores.max = max
+	sshHostSemaphores.m = map[string]chan struct{}{}
+}
+
+// acquireSSHConnection blocks until a connection to the ssh host of rawUrl is allowed
+// and returns the func to release it. Non-ssh urls are not limited.
+func acquireSSHConnection(rawUrl string) (release func()) {
+	host := getSSHHost(rawUrl)
+	sshHostSemaphores.Lock()
+	if host == "" || sshHostSemaphores.max <= 0 {
+		sshHostSemaphores.Unlock()
+		return func() {}
+	}
+	sem, ok := sshHostSemaphores.m[host]
+	if !ok {
+		sem = make(chan struct{}, sshHostSemaphores.max)
+		sshHostSemaphores.m[host] = sem
+	}
+	sshHostSemaphores.Unlock()
+
+	sem <- struct{}{}
+	return func() {
+		<-sem
+	}
+}
+
+func getSSHHost(rawUrl string) (host string) {
+	if strings.HasPrefix(rawUrl, "ssh://") {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	if strings.Contains(rawUrl, "://") {
+		return ""
+	}
+	if m := scpUrlRegexp.FindStringSubmatch(rawUrl); m != nil {
+		return m[2]
+	}
+	return ""
+}
@@ -1,12 +1,40 @@
 package vcs
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/crawlab-team/go-trace"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"os"
 	"path"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
 )
 
-func CreateBareGitRepo(path string) (err error) {
+// defaultBranchName is guarded by defaultBranchNameMu, as clients may be created
+// concurrently with SetDefaultBranchName.
+var (
+	defaultBranchName   = GitDefaultBranchName
+	defaultBranchNameMu sync.RWMutex
+)
+
+func GetDefaultBranchName() (name string) {
+	defaultBranchNameMu.RLock()
+	defer defaultBranchNameMu.RUnlock()
+	return defaultBranchName
+}
+
+func SetDefaultBranchName(name string) {
+	defaultBranchNameMu.Lock()
+	defer defaultBranchNameMu.Unlock()
+	defaultBranchName = name
+}
+
+func CreateBareGitRepo(path string, opts ...GitOption) (err error) {
 	// validate options
 	if path == "" {
 		return ErrInvalidRepoPath
@@ -17,17 +45,37 @@ func CreateBareGitRepo(path string) (err error) {
 		return ErrRepoAlreadyExists
 	}
 
+	// apply options
+	c := &GitClient{
+		repoFileMode: GitDefaultRepoFileMode,
+		repoDirMode:  GitDefaultRepoDirMode,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
 	// create directory if not exists
 	_, err = os.Stat(path)
 	if err != nil {
-		if err := os.MkdirAll(path, os.FileMode(0766)); err != nil {
+		if err := os.MkdirAll(path, c.repoDirMode); err != nil {
 			return err
 		}
 		err = nil
 	}
 
 	// init
-	if _, err := git.PlainInit(path, true); err != nil {
+	r, err := git.PlainInit(path, true)
+	if err != nil {
+		return err
+	}
+
+	// point HEAD to default branch
+	if err := setDefaultBranchHead(r); err != nil {
+		return err
+	}
+
+	// permissions
+	if err := chmodRepo(path, c.repoFileMode, c.repoDirMode); err != nil {
 		return err
 	}
 
@@ -35,6 +83,207 @@ func CreateBareGitRepo(path string) (err error) {
 }
 
 func CloneGitRepo(path, url string, opts ...GitCloneOption) (c *GitClient, err error) {
+	return cloneGitRepo(path, url, false, opts...)
+}
+
+// CloneBareGitRepo clones url into a bare repo at path. Worktree operations of the
+// returned client fail with git.ErrIsBareRepository.
+func CloneBareGitRepo(path, url string, opts ...GitCloneOption) (c *GitClient, err error) {
+	return cloneGitRepo(path, url, true, opts...)
+}
+
+// OpenFromBundle creates a repo at destPath from a git bundle (v2) written by
+// CreateBundle or "git bundle create", restoring its refs and checking out HEAD.
+func OpenFromBundle(bundlePath, destPath string, opts ...GitOption) (c *GitClient, err error) {
+	// header
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	refs, err := readGitBundleHeader(br)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// repo
+	opts = append(opts, WithPath(destPath))
+	c, err = NewGitClient(opts...)
+	if err != nil {
+		return c, err
+	}
+
+	// objects
+	if err := packfile.UpdateObjectStorage(c.r.Storer, br); err != nil {
+		return c, trace.TraceError(err)
+	}
+
+	// refs
+	var headHash plumbing.Hash
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			headHash = ref.Hash()
+			continue
+		}
+		if err := c.r.Storer.SetReference(ref); err != nil {
+			return c, trace.TraceError(err)
+		}
+	}
+
+	// HEAD (attached to a branch at the bundled HEAD, default branch preferred)
+	var headRef *plumbing.Reference
+	if !headHash.IsZero() {
+		headRef = plumbing.NewHashReference(plumbing.HEAD, headHash)
+	}
+	for _, ref := range refs {
+		if !ref.Name().IsBranch() || (!headHash.IsZero() && ref.Hash() != headHash) {
+			continue
+		}
+		if headRef == nil || headRef.Type() == plumbing.HashReference || ref.Name().Short() == GetDefaultBranchName() {
+			headRef = plumbing.NewSymbolicReference(plumbing.HEAD, ref.Name())
+		}
+	}
+	if headRef == nil {
+		// nothing to check out
+		return c, nil
+	}
+	if err := c.r.Storer.SetReference(headRef); err != nil {
+		return c, trace.TraceError(err)
+	}
+
+	// worktree
+	resolvedHeadRef, err := c.r.Head()
+	if err != nil {
+		return c, trace.TraceError(err)
+	}
+	wt, err := c.r.Worktree()
+	if err != nil {
+		return c, trace.TraceError(err)
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: resolvedHeadRef.Hash(), Mode: git.HardReset}); err != nil {
+		return c, trace.TraceError(err)
+	}
+
+	return c, nil
+}
+
+// PullAll pulls clients concurrently with at most concurrency workers and returns
+// errors in the same order as clients. Clients sharing a path (e.g. mem repos backed
+// by the same storage) are pulled sequentially by a single worker.
+func PullAll(clients []*GitClient, concurrency int, opts ...GitPullOption) (errs []error) {
+	errs = make([]error, len(clients))
+
+	// group clients by path
+	var groups [][]int
+	groupIndexes := map[string]int{}
+	for i, c := range clients {
+		key := c.path
+		if c.isMem {
+			key = "mem:" + key
+		}
+		gi, ok := groupIndexes[key]
+		if !ok {
+			gi = len(groups)
+			groupIndexes[key] = gi
+			groups = append(groups, nil)
+		}
+		groups[gi] = append(groups[gi], i)
+	}
+
+	// concurrency
+	if concurrency <= 0 || concurrency > len(groups) {
+		concurrency = len(groups)
+	}
+
+	// workers
+	groupCh := make(chan []int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range groupCh {
+				for _, i := range group {
+					errs[i] = clients[i].Pull(opts...)
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		groupCh <- group
+	}
+	close(groupCh)
+	wg.Wait()
+
+	return errs
+}
+
+func IsGitRepoExists(repoPath string) (ok bool) {
+	ok, _ = IsGitRepoExistsWithContext(context.Background(), repoPath)
+	return ok
+}
+
+// IsGitRepoExistsWithContext checks whether repoPath is a git repo (non-bare or bare)
+// with local file stats only. Unlike IsGitRepoExists, errors other than "not exists"
+// (e.g. permission denied) are returned, and ctx bounds the time spent on slow filesystems.
+func IsGitRepoExistsWithContext(ctx context.Context, repoPath string) (ok bool, err error) {
+	type result struct {
+		ok  bool
+		err error
+	}
+	resCh := make(chan result, 1)
+
+	go func() {
+		for _, p := range []string{
+			path.Join(repoPath, git.GitDirName),
+			path.Join(repoPath, "HEAD"),
+		} {
+			_, err := os.Stat(p)
+			if err == nil {
+				resCh <- result{ok: true}
+				return
+			}
+			if !os.IsNotExist(err) {
+				resCh <- result{err: err}
+				return
+			}
+		}
+		resCh <- result{}
+	}()
+
+	select {
+	case res := <-resCh:
+		return res.ok, res.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// FindRepoRoot walks up from startPath looking for a .git entry, like git rev-parse
+// --show-toplevel, and returns the root of the enclosing repo if found.
+func FindRepoRoot(startPath string) (root string, ok bool, err error) {
+	p, err := filepath.Abs(startPath)
+	if err != nil {
+		return "", false, trace.TraceError(err)
+	}
+	for {
+		_, err := os.Stat(filepath.Join(p, git.GitDirName))
+		if err == nil {
+			return p, true, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, trace.TraceError(err)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", false, nil
+		}
+		p = parent
+	}
+}
+
+func cloneGitRepo(path, url string, isBare bool, opts ...GitCloneOption) (c *GitClient, err error) {
 	// url
 	opts = append(opts, WithURL(url))
 
@@ -45,23 +294,53 @@ func CloneGitRepo(path, url string, opts ...GitCloneOption) (c *GitClient, err e
 	}
 
 	// clone
-	if _, err := git.PlainClone(path, false, o); err != nil {
+	if _, err := git.PlainClone(path, isBare, o); err != nil {
 		return nil, err
 	}
 
 	return NewGitClient(WithPath(path))
 }
 
-func IsGitRepoExists(repoPath string) (ok bool) {
-	dotGitPath := path.Join(repoPath, git.GitDirName)
-	if _, err := os.Stat(dotGitPath); err == nil {
+func setDefaultBranchHead(r *git.Repository) (err error) {
+	headRef := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(GetDefaultBranchName()))
+	return r.Storer.SetReference(headRef)
+}
+
+func chmodRepo(repoPath string, fileMode, dirMode os.FileMode) (err error) {
+	return filepath.Walk(repoPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if info.IsDir() {
+			return os.Chmod(p, dirMode)
+		}
+		return os.Chmod(p, fileMode)
+	})
+}
+
+// IsBinaryContent reports whether data looks binary rather than text: its leading
+// GitBinaryCheckSize bytes contain a null byte or are not valid UTF-8. A multi-byte
+// character cut off at the end of the inspected bytes is not taken as invalid.
+func IsBinaryContent(data []byte) bool {
+	if len(data) > GitBinaryCheckSize {
+		data = data[:GitBinaryCheckSize]
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
 		return true
 	}
 
-	headPath := path.Join(repoPath, "HEAD")
-	if _, err := os.Stat(headPath); err == nil {
-		return true
+	// drop an incomplete trailing character
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data = data[:i]
+			}
+			break
+		}
 	}
 
-	return false
+	return !utf8.Valid(data)
 }
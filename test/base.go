@@ -2,8 +2,10 @@ package test
 
 import (
 	vcs "github.com/crawlab-team/crawlab-vcs"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"sync"
 	"testing"
@@ -37,6 +39,7 @@ type Test struct {
 	InitialCommitMessage     string
 	InitialReadmeFileName    string
 	InitialReadmeFileContent string
+	ConflictFileName         string
 }
 
 func (t *Test) Setup(t2 *testing.T) {
@@ -67,6 +70,37 @@ func (t *Test) Setup(t2 *testing.T) {
 	}
 }
 
+// CreateConflict edits the conflict file divergently on master and the test branch
+// of the local repo, then merges the test branch into master with the git binary
+// (go-git does not support merging) so that the file is left conflicted.
+func (t *Test) CreateConflict(t2 *testing.T) {
+	// base
+	filePath := path.Join(t.LocalRepoPath, t.ConflictFileName)
+	require.Nil(t2, ioutil.WriteFile(filePath, []byte("base\n"), os.FileMode(0766)))
+	require.Nil(t2, t.LocalRepo.CommitAll("base"))
+
+	// theirs
+	require.Nil(t2, t.LocalRepo.CheckoutBranch(t.TestBranchName))
+	require.Nil(t2, ioutil.WriteFile(filePath, []byte("theirs\n"), os.FileMode(0766)))
+	require.Nil(t2, t.LocalRepo.CommitAll("theirs"))
+
+	// ours
+	require.Nil(t2, t.LocalRepo.Checkout(vcs.WithBranch(vcs.GitBranchNameMaster)))
+	require.Nil(t2, ioutil.WriteFile(filePath, []byte("ours\n"), os.FileMode(0766)))
+	require.Nil(t2, t.LocalRepo.CommitAll("ours"))
+
+	// merge
+	cmd := exec.Command("git", "merge", t.TestBranchName)
+	cmd.Dir = t.LocalRepoPath
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t2, err, &exitErr, string(out))
+	require.Equal(t2, 1, exitErr.ExitCode(), string(out))
+	data, err := ioutil.ReadFile(filePath)
+	require.Nil(t2, err)
+	require.Contains(t2, string(data), "<<<<<<<")
+}
+
 func (t *Test) Cleanup() {
 	if err := T.LocalRepo.Dispose(); err != nil {
 		panic(err)
@@ -123,7 +157,7 @@ func NewTest() (t *Test, err error) {
 	t.TestBranchName = "develop"
 
 	// test commit message
-	t.InitialCommitMessage = "test commit"
+	t.TestCommitMessage = "test commit"
 
 	// initial commit message
 	t.InitialCommitMessage = "initial commit"
@@ -134,5 +168,8 @@ func NewTest() (t *Test, err error) {
 	// initial readme file content
 	t.InitialReadmeFileContent = "README"
 
+	// conflict file name
+	t.ConflictFileName = "conflict.txt"
+
 	return t, nil
 }
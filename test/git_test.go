@@ -1,17 +1,39 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/crawlab-team/crawlab-vcs"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -509,3 +531,4657 @@ func TestGitClient_IsRemoteChanged(t *testing.T) {
 	require.Nil(t, err)
 	require.False(t, ok)
 }
+
+func TestGitClient_GetUnpushedCommits(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// no unpushed commits
+	logs, err := T.LocalRepo.GetUnpushedCommits("", "")
+	require.Nil(t, err)
+	require.Len(t, logs, 0)
+
+	// commit without pushing
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("unpushed commit")
+	require.Nil(t, err)
+
+	// validate
+	logs, err = T.LocalRepo.GetUnpushedCommits(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, "unpushed commit", logs[0].Msg)
+}
+
+func TestGitClient_ReplaceRemoteHost(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// remotes on the old host
+	_, err = T.LocalRepo.CreateRemote(&config.RemoteConfig{
+		Name: vcs.GitRemoteNameUpstream,
+		URLs: []string{"https://old.example.com/crawlab/spider.git"},
+	})
+	require.Nil(t, err)
+	_, err = T.LocalRepo.CreateRemote(&config.RemoteConfig{
+		Name: vcs.GitRemoteNameCrawlab,
+		URLs: []string{"git@old.example.com:crawlab/spider.git"},
+	})
+	require.Nil(t, err)
+
+	// replace host
+	err = T.LocalRepo.ReplaceRemoteHost("old.example.com", "new.example.com")
+	require.Nil(t, err)
+
+	// validate
+	r, err := T.LocalRepo.GetRemote(vcs.GitRemoteNameUpstream)
+	require.Nil(t, err)
+	require.Equal(t, "https://new.example.com/crawlab/spider.git", r.Config().URLs[0])
+	r, err = T.LocalRepo.GetRemote(vcs.GitRemoteNameCrawlab)
+	require.Nil(t, err)
+	require.Equal(t, "git@new.example.com:crawlab/spider.git", r.Config().URLs[0])
+	r, err = T.LocalRepo.GetRemote(vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	require.Equal(t, T.RemoteRepoPath, r.Config().URLs[0])
+}
+
+func TestGitClient_ReadWriteMemFile(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+
+	// write
+	filePath := path.Join("spiders", T.TestFileName)
+	err = c.WriteMemFile(filePath, []byte(T.TestFileContent))
+	require.Nil(t, err)
+
+	// read
+	data, err := c.ReadMemFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// commit
+	err = c.CommitAll("mem commit")
+	require.Nil(t, err)
+	status, err := c.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+
+	// fs repo
+	_, err = T.LocalRepo.ReadMemFile(filePath)
+	require.ErrorIs(t, err, vcs.ErrNotMemRepo)
+}
+
+func TestSetDefaultBranchName(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// set default branch name
+	vcs.SetDefaultBranchName(vcs.GitBranchNameMain)
+	defer vcs.SetDefaultBranchName(vcs.GitDefaultBranchName)
+	require.Equal(t, vcs.GitBranchNameMain, vcs.GetDefaultBranchName())
+
+	// concurrent access (checked by the race detector)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vcs.SetDefaultBranchName(vcs.GitBranchNameMain)
+			_ = vcs.GetDefaultBranchName()
+		}()
+	}
+	wg.Wait()
+
+	// bare repo
+	bareRepoPath := path.Join("./tmp", "test_bare_repo")
+	err = vcs.CreateBareGitRepo(bareRepoPath)
+	require.Nil(t, err)
+	defer os.RemoveAll(bareRepoPath)
+
+	// validate
+	r, err := git.PlainOpen(bareRepoPath)
+	require.Nil(t, err)
+	headRef, err := r.Reference(plumbing.HEAD, false)
+	require.Nil(t, err)
+	require.Equal(t, plumbing.NewBranchReferenceName(vcs.GitBranchNameMain), headRef.Target())
+}
+
+func TestGitClient_Move(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("add test file")
+	require.Nil(t, err)
+
+	// move
+	newFilePath := path.Join("spiders", T.TestFileName)
+	err = T.LocalRepo.Move(T.TestFileName, newFilePath)
+	require.Nil(t, err)
+	err = T.LocalRepo.Commit("move test file")
+	require.Nil(t, err)
+
+	// diff head against its parent
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	commit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	parent, err := commit.Parent(0)
+	require.Nil(t, err)
+	tree, err := commit.Tree()
+	require.Nil(t, err)
+	parentTree, err := parent.Tree()
+	require.Nil(t, err)
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	require.Nil(t, err)
+
+	// validate
+	require.Len(t, changes, 1)
+	require.Equal(t, T.TestFileName, changes[0].From.Name)
+	require.Equal(t, newFilePath, changes[0].To.Name)
+}
+
+func TestGitClient_FetchWithShallowSince(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits with increasing committer dates
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		filePath := path.Join(T.LocalRepoPath, fmt.Sprintf("test-%d.txt", i))
+		err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+		sig := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: now.Add(time.Duration(i) * time.Hour)}
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("commit %d", i), vcs.WithAuthor(sig), vcs.WithCommitter(sig))
+		require.Nil(t, err)
+	}
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git client (without checking out the remote default branch on init)
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithNoAutoRemote(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.AddRemote(vcs.GitRemoteNameOrigin, T.RemoteRepoPath)
+	require.Nil(t, err)
+
+	// fetch commits newer than the second one
+	err = c.Fetch(vcs.WithShallowSince(now.Add(150 * time.Minute)))
+	require.Nil(t, err)
+
+	// validate
+	r := c.GetRepository()
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), true)
+	require.Nil(t, err)
+	commit, err := r.CommitObject(ref.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "commit 3", commit.Message)
+	shallows, err := r.Storer.Shallow()
+	require.Nil(t, err)
+	require.Equal(t, []plumbing.Hash{ref.Hash()}, shallows)
+	_, err = r.CommitObject(commit.ParentHashes[0])
+	require.NotNil(t, err)
+	commit3Hash := ref.Hash()
+
+	// fetch again after a new commit (shallow boundaries are not duplicated)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "test-4.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	sig := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: now.Add(4 * time.Hour)}
+	err = T.LocalRepo.CommitAll("commit 4", vcs.WithAuthor(sig), vcs.WithCommitter(sig))
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = c.Fetch(vcs.WithShallowSince(now.Add(150 * time.Minute)))
+	require.Nil(t, err)
+	ref, err = r.Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), true)
+	require.Nil(t, err)
+	commit, err = r.CommitObject(ref.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "commit 4", commit.Message)
+	commit4Hash := ref.Hash()
+	shallows, err = r.Storer.Shallow()
+	require.Nil(t, err)
+	require.Equal(t, []plumbing.Hash{commit3Hash}, shallows)
+
+	// rewritten remote branch
+	err = T.LocalRepo.Reset(vcs.WithCommit(commit3Hash), vcs.WithMode(git.HardReset))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "test-5.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	sig = &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: now.Add(5 * time.Hour)}
+	err = T.LocalRepo.CommitAll("commit 5", vcs.WithAuthor(sig), vcs.WithCommitter(sig))
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithForcePush(true))
+	require.Nil(t, err)
+
+	// not fast-forwarded without "+" in the refspec
+	err = c.Fetch(
+		vcs.WithShallowSince(now.Add(150*time.Minute)),
+		vcs.WithFetchRefSpecs([]config.RefSpec{"refs/heads/*:refs/remotes/origin/*"}),
+	)
+	require.ErrorIs(t, err, git.ErrForceNeeded)
+	ref, err = r.Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), true)
+	require.Nil(t, err)
+	require.Equal(t, commit4Hash, ref.Hash())
+
+	// forced by the default refspec
+	err = c.Fetch(vcs.WithShallowSince(now.Add(150 * time.Minute)))
+	require.Nil(t, err)
+	ref, err = r.Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), true)
+	require.Nil(t, err)
+	commit, err = r.CommitObject(ref.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "commit 5", commit.Message)
+}
+
+func TestGitClient_GetAllRefs(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// branch, tag and remote-tracking ref
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	_, err = r.CreateTag("v0.0.1", headRef.Hash(), nil)
+	require.Nil(t, err)
+
+	// get all refs
+	refs, err := T.LocalRepo.GetAllRefs()
+	require.Nil(t, err)
+	refsMap := map[string]vcs.GitRef{}
+	for _, ref := range refs {
+		refsMap[ref.FullName] = ref
+	}
+
+	// validate
+	require.Equal(t, vcs.GitRefTypeBranch, refsMap["refs/heads/master"].Type)
+	require.Equal(t, vcs.GitRefTypeTag, refsMap["refs/tags/v0.0.1"].Type)
+	require.Equal(t, vcs.GitRefTypeRemote, refsMap["refs/remotes/origin/master"].Type)
+	head, ok := refsMap["HEAD"]
+	require.True(t, ok)
+	require.Equal(t, vcs.GitRefTypeOther, head.Type)
+	require.True(t, head.IsSymbolic)
+	require.Equal(t, "refs/heads/master", head.Target)
+	require.Equal(t, headRef.Hash().String(), head.Hash)
+}
+
+func TestCreateBareGitRepo_Permissions(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// default permissions
+	fi, err := os.Stat(T.RemoteRepoPath)
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitDefaultRepoDirMode, fi.Mode().Perm())
+	fi, err = os.Stat(path.Join(T.RemoteRepoPath, "HEAD"))
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitDefaultRepoFileMode, fi.Mode().Perm())
+
+	// custom permissions
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRepoPermissions(os.FileMode(0600), os.FileMode(0700)),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	fi, err = os.Stat(T.FsRepoPath)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+	fi, err = os.Stat(path.Join(T.FsRepoPath, git.GitDirName, "HEAD"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func TestGitClient_PullAndFetchWithTags(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// tag and push
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	_, err = r.CreateTag("v0.0.1", headRef.Hash(), nil)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithRefSpecs([]config.RefSpec{
+		"refs/heads/*:refs/heads/*",
+		"refs/tags/*:refs/tags/*",
+	}))
+	require.Nil(t, err)
+
+	// git client (without checking out the remote default branch on init)
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithNoAutoRemote(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.AddRemote(vcs.GitRemoteNameOrigin, T.RemoteRepoPath)
+	require.Nil(t, err)
+
+	// pull without tags
+	err = c.Pull(
+		vcs.WithBranchNamePull(vcs.GitBranchNameMaster),
+		vcs.WithTagsPull(git.NoTags),
+	)
+	require.Nil(t, err)
+	_, err = os.Stat(path.Join(T.FsRepoPath, T.InitialReadmeFileContent))
+	require.Nil(t, err)
+	tags, err := c.GetTags()
+	require.Nil(t, err)
+	require.Len(t, tags, 0)
+
+	// fetch without tags
+	err = c.Fetch(vcs.WithTagsFetch(git.NoTags))
+	require.Nil(t, err)
+	tags, err = c.GetTags()
+	require.Nil(t, err)
+	require.Len(t, tags, 0)
+
+	// pull with all tags
+	err = c.Pull(
+		vcs.WithBranchNamePull(vcs.GitBranchNameMaster),
+		vcs.WithTagsPull(git.AllTags),
+	)
+	require.Nil(t, err)
+	tags, err = c.GetTags()
+	require.Nil(t, err)
+	require.Len(t, tags, 1)
+	require.Equal(t, "v0.0.1", tags[0].Name)
+
+	// pull with an option setting git.PullOptions directly
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = c.Pull(vcs.WithPullOptions(func(o *git.PullOptions) {
+		o.ReferenceName = plumbing.NewBranchReferenceName(vcs.GitBranchNameMaster)
+	}))
+	require.Nil(t, err)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+}
+
+func TestGitClient_Sync_FastForward(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.Pull(vcs.WithBranchNamePull(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+
+	// commit and push from local repo
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("remote commit")
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// sync
+	res, err := c.Sync("", "")
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitSyncStatusFastForwarded, res.Status)
+	require.Equal(t, 0, res.Ahead)
+	require.Equal(t, 1, res.Behind)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// sync again
+	res, err = c.Sync("", "")
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitSyncStatusUpToDate, res.Status)
+}
+
+func TestGitClient_Sync_Diverged(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.Pull(vcs.WithBranchNamePull(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+
+	// commit and push from local repo
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("remote commit")
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// commit locally
+	err = ioutil.WriteFile(path.Join(T.FsRepoPath, "local.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll("local commit")
+	require.Nil(t, err)
+	headRef, err := c.GetRepository().Head()
+	require.Nil(t, err)
+
+	// sync
+	res, err := c.Sync(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitSyncStatusDiverged, res.Status)
+	require.Equal(t, 1, res.Ahead)
+	require.Equal(t, 1, res.Behind)
+	require.Equal(t, headRef.Hash().String(), res.Hash)
+	_, err = os.Stat(path.Join(T.FsRepoPath, T.TestFileName))
+	require.NotNil(t, err)
+}
+
+func TestGitClient_CommitBinaryFile(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// png-like binary content with nulls
+	data := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00, 0x00, 0x0d, 'I', 'H', 'D', 'R', 0x00, 0xff, 0xfe, '\r', '\n', 0x00}
+	fileName := "image.png"
+
+	// fs
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fileName), data, os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("add binary file")
+	require.Nil(t, err)
+	content, err := T.LocalRepo.GetFileContentAtRef(fileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, data, content)
+
+	// mem
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+	err = c.WriteMemFile(fileName, data)
+	require.Nil(t, err)
+	err = c.CommitAll("add binary file")
+	require.Nil(t, err)
+	content, err = c.GetFileContentAtRef(fileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, data, content)
+
+	// not found
+	_, err = c.GetFileContentAtRef("missing.png", "HEAD")
+	require.ErrorIs(t, err, vcs.ErrFileNotFoundInTree)
+}
+
+func TestNewGitClient_NoAutoRemote(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithNoAutoRemote(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// validate
+	remotes, err := c.GetRepository().Remotes()
+	require.Nil(t, err)
+	require.Len(t, remotes, 0)
+
+	// add remote manually
+	err = c.AddRemote(vcs.GitRemoteNameUpstream, T.RemoteRepoPath)
+	require.Nil(t, err)
+	remotes, err = c.GetRepository().Remotes()
+	require.Nil(t, err)
+	require.Len(t, remotes, 1)
+	require.Equal(t, vcs.GitRemoteNameUpstream, remotes[0].Config().Name)
+}
+
+func TestGitClient_GetConflictVersions(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// no conflict
+	_, _, _, err = T.LocalRepo.GetConflictVersions(T.InitialReadmeFileContent)
+	require.ErrorIs(t, err, vcs.ErrNoConflict)
+
+	// conflict
+	T.CreateConflict(t)
+
+	// validate
+	base, ours, theirs, err := T.LocalRepo.GetConflictVersions(T.ConflictFileName)
+	require.Nil(t, err)
+	require.Equal(t, "base\n", string(base))
+	require.Equal(t, "ours\n", string(ours))
+	require.Equal(t, "theirs\n", string(theirs))
+}
+
+func TestGitClient_ResolveConflictAndContinueMerge(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// conflict
+	T.CreateConflict(t)
+
+	// continue before resolving
+	err = T.LocalRepo.ContinueMerge("merge")
+	require.ErrorIs(t, err, vcs.ErrUnresolvedConflicts)
+
+	// resolve
+	err = T.LocalRepo.ResolveConflict(T.ConflictFileName, []byte("resolved\n"))
+	require.Nil(t, err)
+	_, _, _, err = T.LocalRepo.GetConflictVersions(T.ConflictFileName)
+	require.ErrorIs(t, err, vcs.ErrNoConflict)
+
+	// continue
+	err = T.LocalRepo.ContinueMerge("merge " + T.TestBranchName)
+	require.Nil(t, err)
+
+	// validate
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	commit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "merge "+T.TestBranchName, commit.Message)
+	require.Len(t, commit.ParentHashes, 2)
+	content, err := T.LocalRepo.GetFileContentAtRef(T.ConflictFileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "resolved\n", string(content))
+	_, err = r.Reference(vcs.GitMergeHead, false)
+	require.Equal(t, plumbing.ErrReferenceNotFound, err)
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+}
+
+func TestGitClient_WithLogger(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git client with logger
+	var events []string
+	var dump string
+	logger := func(level, msg string, kv ...interface{}) {
+		events = append(events, msg)
+		dump += fmt.Sprintf("%s %s %v\n", level, msg, kv)
+	}
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithAuthType(vcs.GitAuthTypeHTTP),
+		vcs.WithUsername("crawlab"),
+		vcs.WithPassword("secret-password"),
+		vcs.WithLogger(logger),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	events = nil
+
+	// pull
+	err = c.Pull(vcs.WithBranchNamePull(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+
+	// validate
+	require.Equal(t, []string{"auth selected", "pull started", "pull finished"}, events)
+	require.Contains(t, dump, "http")
+	require.NotContains(t, dump, "secret-password")
+}
+
+func TestGitClient_GetWorktreeTreeHash(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "spiders"), os.FileMode(0766))
+	require.Nil(t, err)
+	filePath := path.Join(T.LocalRepoPath, "spiders", T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("add test file")
+	require.Nil(t, err)
+
+	// tree hash of clean worktree equals head tree hash
+	hash, err := T.LocalRepo.GetWorktreeTreeHash()
+	require.Nil(t, err)
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	commit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	require.Equal(t, commit.TreeHash.String(), hash)
+
+	// modify
+	err = ioutil.WriteFile(filePath, []byte("modified"), os.FileMode(0766))
+	require.Nil(t, err)
+	modifiedHash, err := T.LocalRepo.GetWorktreeTreeHash()
+	require.Nil(t, err)
+	require.NotEqual(t, hash, modifiedHash)
+
+	// revert
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	revertedHash, err := T.LocalRepo.GetWorktreeTreeHash()
+	require.Nil(t, err)
+	require.Equal(t, hash, revertedHash)
+}
+
+func TestGitClient_CommitWithCommitterIdentity(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(
+		"commit with committer",
+		vcs.WithAuthor(&object.Signature{Name: "developer", Email: "developer@example.com", When: time.Now()}),
+		vcs.WithCommitterIdentity("crawlab-bot", "bot@crawlab.cn"),
+	)
+	require.Nil(t, err)
+
+	// validate
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	commit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "developer", commit.Author.Name)
+	require.Equal(t, "developer@example.com", commit.Author.Email)
+	require.Equal(t, "crawlab-bot", commit.Committer.Name)
+	require.Equal(t, "bot@crawlab.cn", commit.Committer.Email)
+
+	// option setting git.CommitOptions directly
+	err = ioutil.WriteFile(filePath, []byte(T.TestBranchName), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(
+		"commit with go-git options",
+		vcs.WithCommitOptions(func(o *git.CommitOptions) {
+			o.Committer = &object.Signature{Name: "go-git", Email: "go-git@example.com", When: time.Now()}
+		}),
+	)
+	require.Nil(t, err)
+	headRef, err = r.Head()
+	require.Nil(t, err)
+	commit, err = r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	require.Equal(t, "go-git", commit.Committer.Name)
+	require.Equal(t, "go-git@example.com", commit.Committer.Email)
+}
+
+func TestIsGitRepoExistsWithContext(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// valid repo
+	ok, err := vcs.IsGitRepoExistsWithContext(ctx, T.LocalRepoPath)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// bare repo
+	ok, err = vcs.IsGitRepoExistsWithContext(ctx, T.RemoteRepoPath)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// nonexistent path
+	ok, err = vcs.IsGitRepoExistsWithContext(ctx, "./tmp/not_exists")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// path error (file used as directory)
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	ok, err = vcs.IsGitRepoExistsWithContext(ctx, filePath)
+	require.NotNil(t, err)
+	require.False(t, ok)
+
+	// cancelled context
+	cancelledCtx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+	_, err = vcs.IsGitRepoExistsWithContext(cancelledCtx, "./tmp/not_exists")
+	if err != nil {
+		require.ErrorIs(t, err, context.Canceled)
+	}
+
+	// unreadable directory (permissions do not apply to root)
+	if os.Geteuid() != 0 {
+		dirPath := "./tmp/test_unreadable"
+		err = os.MkdirAll(dirPath, os.FileMode(0000))
+		require.Nil(t, err)
+		defer os.RemoveAll(dirPath)
+		defer os.Chmod(dirPath, os.FileMode(0755))
+		ok, err = vcs.IsGitRepoExistsWithContext(ctx, dirPath)
+		require.True(t, os.IsPermission(err))
+		require.False(t, ok)
+	}
+}
+
+func TestGitClient_RestoreFile(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	filePath := path.Join("spiders", T.TestFileName)
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "spiders"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, filePath), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("add test file")
+	require.Nil(t, err)
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	hash := logs[0].Hash
+
+	// delete and commit
+	err = os.RemoveAll(path.Join(T.LocalRepoPath, "spiders"))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("delete test file", vcs.WithAll(true))
+	require.Nil(t, err)
+	_, err = T.LocalRepo.GetFileContentAtRef(filePath, "HEAD")
+	require.ErrorIs(t, err, vcs.ErrFileNotFoundInTree)
+
+	// restore
+	err = T.LocalRepo.RestoreFile(filePath, hash)
+	require.Nil(t, err)
+
+	// validate
+	data, err := ioutil.ReadFile(path.Join(T.LocalRepoPath, filePath))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 1)
+	require.Equal(t, "A", status[0].Staging)
+
+	// not found at ref
+	err = T.LocalRepo.RestoreFile("missing.txt", hash)
+	require.ErrorIs(t, err, vcs.ErrFileNotFoundInTree)
+}
+
+func TestGitClient_WithFollowRedirects(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git http server
+	gitBin, err := exec.LookPath("git")
+	require.Nil(t, err)
+	remoteRoot, err := filepath.Abs(path.Dir(T.RemoteRepoPath))
+	require.Nil(t, err)
+	gitServer := httptest.NewServer(&cgi.Handler{
+		Path: gitBin,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + remoteRoot,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	})
+	defer gitServer.Close()
+
+	// redirecting server
+	redirectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, gitServer.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}))
+	defer redirectServer.Close()
+	remoteUrl := redirectServer.URL + "/" + path.Base(T.RemoteRepoPath)
+
+	// follow
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(remoteUrl),
+		vcs.WithFollowRedirects(true),
+	)
+	require.Nil(t, err)
+	err = c.Fetch()
+	require.Nil(t, err)
+	refs, err := c.GetRemoteRefs(vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	require.NotEmpty(t, refs)
+	require.Nil(t, c.Dispose())
+
+	// no follow
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(remoteUrl),
+		vcs.WithFollowRedirects(false),
+	)
+	require.Nil(t, err)
+	err = c.Fetch()
+	require.ErrorIs(t, err, vcs.ErrHttpRedirectNotAllowed)
+	_, err = c.GetRemoteRefs(vcs.GitRemoteNameOrigin)
+	require.ErrorIs(t, err, vcs.ErrHttpRedirectNotAllowed)
+	require.Nil(t, c.Dispose())
+}
+
+func TestGitClient_GetDirLogs(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits touching different directories
+	for _, dir := range []string{"spider_a", "spider_b", "spider_a"} {
+		err = os.MkdirAll(path.Join(T.LocalRepoPath, dir), os.FileMode(0766))
+		require.Nil(t, err)
+		filePath := path.Join(T.LocalRepoPath, dir, T.TestFileName)
+		err = ioutil.WriteFile(filePath, []byte(time.Now().String()), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll("update " + dir)
+		require.Nil(t, err)
+	}
+
+	// spider_a
+	logs, err := T.LocalRepo.GetDirLogs("spider_a")
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	for _, l := range logs {
+		require.Equal(t, "update spider_a", l.Msg)
+	}
+
+	// spider_b
+	logs, err = T.LocalRepo.GetDirLogs("spider_b/")
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, "update spider_b", logs[0].Msg)
+
+	// directory name prefix is not a match
+	logs, err = T.LocalRepo.GetDirLogs("spider")
+	require.Nil(t, err)
+	require.Len(t, logs, 0)
+
+	// root
+	logs, err = T.LocalRepo.GetDirLogs("")
+	require.Nil(t, err)
+	require.Len(t, logs, 4)
+}
+
+func TestGitClient_GetHeadHash(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// committed repo
+	hash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Len(t, hash, 40)
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Equal(t, logs[0].Hash, hash)
+
+	// fresh repo
+	c, err := vcs.NewGitClient(vcs.WithPath(T.FsRepoPath))
+	require.Nil(t, err)
+	_, err = c.GetHeadHash()
+	require.ErrorIs(t, err, vcs.ErrNoCommits)
+	require.Nil(t, c.Dispose())
+}
+
+func TestGitClient_WithCommitMessageTemplate(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// empty message without template
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("")
+	require.ErrorIs(t, err, vcs.ErrEmptyCommitMessage)
+
+	// empty message with template
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithCommitMessageTemplate("auto commit on {{.Branch}}: {{.FileCount}} file(s) at {{.Timestamp.Format \"2006\"}}"),
+	)
+	require.Nil(t, err)
+	err = c.CommitAll("")
+	require.Nil(t, err)
+
+	// validate
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	expected := fmt.Sprintf("auto commit on %s: 1 file(s) at %d", vcs.GitBranchNameMaster, time.Now().Year())
+	require.Equal(t, expected, logs[0].Msg)
+}
+
+func TestGitClient_WithSignKeyFile(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// key pair
+	entity, err := openpgp.NewEntity("test", "", "test@crawlab.cn", nil)
+	require.Nil(t, err)
+	var privBuf bytes.Buffer
+	w, err := armor.Encode(&privBuf, openpgp.PrivateKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, entity.SerializePrivate(w, nil))
+	require.Nil(t, w.Close())
+	var pubBuf bytes.Buffer
+	w, err = armor.Encode(&pubBuf, openpgp.PublicKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, entity.Serialize(w))
+	require.Nil(t, w.Close())
+
+	// encrypted key file
+	passphrase := "passphrase"
+	require.Nil(t, entity.EncryptPrivateKeys([]byte(passphrase), nil))
+	var encBuf bytes.Buffer
+	w, err = armor.Encode(&encBuf, openpgp.PrivateKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, entity.SerializePrivateWithoutSigning(w, nil))
+	require.Nil(t, w.Close())
+	keyFilePath := path.Join(T.LocalRepoPath, "..", "sign_key.asc")
+	err = ioutil.WriteFile(keyFilePath, encBuf.Bytes(), os.FileMode(0600))
+	require.Nil(t, err)
+	defer os.Remove(keyFilePath)
+
+	// unsigned commit
+	err = T.LocalRepo.VerifyCommit("HEAD", pubBuf.String())
+	require.ErrorIs(t, err, vcs.ErrCommitNotSigned)
+
+	// commit with key file
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithSignKeyFile(keyFilePath, passphrase),
+	)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = c.VerifyCommit("HEAD", pubBuf.String())
+	require.Nil(t, err)
+
+	// key is read once at init
+	require.Nil(t, os.Rename(keyFilePath, keyFilePath+".bak"))
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent+"\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = c.VerifyCommit("HEAD", pubBuf.String())
+	require.Nil(t, err)
+	require.Nil(t, os.Rename(keyFilePath+".bak", keyFilePath))
+
+	// invalid passphrase or key file fails at init
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithSignKeyFile(keyFilePath, "wrong"),
+	)
+	require.NotNil(t, err)
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithSignKeyFile(keyFilePath+".missing", passphrase),
+	)
+	require.NotNil(t, err)
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithSignKeyBytes(pubBuf.Bytes(), ""),
+	)
+	require.ErrorIs(t, err, vcs.ErrInvalidSignKey)
+
+	// commit with key bytes
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithSignKeyBytes(privBuf.Bytes(), ""),
+	)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestBranchName), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = c.VerifyCommit("HEAD", pubBuf.String())
+	require.Nil(t, err)
+}
+
+func TestGitClient_AbortMerge(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// nothing to abort
+	err = T.LocalRepo.AbortMerge()
+	require.ErrorIs(t, err, vcs.ErrNoMergeInProgress)
+
+	// conflict
+	T.CreateConflict(t)
+	r := T.LocalRepo.GetRepository()
+	_, err = r.Reference(vcs.GitMergeHead, false)
+	require.Nil(t, err)
+
+	// abort
+	err = T.LocalRepo.AbortMerge()
+	require.Nil(t, err)
+
+	// validate
+	data, err := ioutil.ReadFile(path.Join(T.LocalRepoPath, T.ConflictFileName))
+	require.Nil(t, err)
+	require.Equal(t, "ours\n", string(data))
+	_, _, _, err = T.LocalRepo.GetConflictVersions(T.ConflictFileName)
+	require.ErrorIs(t, err, vcs.ErrNoConflict)
+	_, err = r.Reference(vcs.GitMergeHead, false)
+	require.Equal(t, plumbing.ErrReferenceNotFound, err)
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+}
+
+func TestPullAll(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// clients pulling from the common remote
+	var clients []*vcs.GitClient
+	for i := 0; i < 4; i++ {
+		c, err := vcs.NewGitClient(
+			vcs.WithPath(fmt.Sprintf("%s_%d", T.FsRepoPath, i)),
+			vcs.WithRemoteUrl(T.RemoteRepoPath),
+		)
+		require.Nil(t, err)
+		defer c.Dispose()
+		clients = append(clients, c)
+	}
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// pull all
+	errs := vcs.PullAll(clients, 2)
+	require.Len(t, errs, len(clients))
+	for _, err := range errs {
+		require.Nil(t, err)
+	}
+
+	// validate
+	hash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	for _, c := range clients {
+		h, err := c.GetHeadHash()
+		require.Nil(t, err)
+		require.Equal(t, hash, h)
+		data, err := ioutil.ReadFile(path.Join(c.GetPath(), T.TestFileName))
+		require.Nil(t, err)
+		require.Equal(t, T.TestFileContent, string(data))
+	}
+}
+
+func TestGitClient_Init_RemoteDefaultBranch(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// remote with HEAD pointing at main
+	err = T.LocalRepo.MoveBranch(vcs.GitBranchNameMaster, vcs.GitBranchNameMain)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithRefSpecs([]config.RefSpec{"refs/heads/main:refs/heads/main"}))
+	require.Nil(t, err)
+	cmd := exec.Command("git", "symbolic-ref", "HEAD", "refs/heads/main")
+	cmd.Dir = T.RemoteRepoPath
+	require.Nil(t, cmd.Run())
+
+	// clone
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// validate
+	branch, err := c.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMain, branch)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.InitialReadmeFileContent))
+	require.Nil(t, err)
+	require.Equal(t, T.InitialReadmeFileContent, string(data))
+}
+
+func TestGitClient_UpdateSubmodulesWithDepth(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// submodule remote with a long history
+	subRemotePath, err := filepath.Abs(path.Join(path.Dir(T.RemoteRepoPath), "test_sub_remote_repo"))
+	require.Nil(t, err)
+	err = vcs.CreateBareGitRepo(subRemotePath)
+	require.Nil(t, err)
+	defer os.RemoveAll(subRemotePath)
+	sub, err := vcs.NewGitClient(
+		vcs.WithPath(path.Join(path.Dir(T.RemoteRepoPath), "test_sub_local_repo")),
+		vcs.WithRemoteUrl(subRemotePath),
+	)
+	require.Nil(t, err)
+	defer sub.Dispose()
+	for i := 0; i < 3; i++ {
+		err = ioutil.WriteFile(path.Join(sub.GetPath(), T.TestFileName), []byte(fmt.Sprintf("%d", i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = sub.CommitAll(fmt.Sprintf("commit %d", i))
+		require.Nil(t, err)
+	}
+	err = sub.Push()
+	require.Nil(t, err)
+
+	// add submodule and push
+	cmd := exec.Command("git", "-c", "protocol.file.allow=always", "submodule", "add", subRemotePath, "sub")
+	cmd.Dir = T.LocalRepoPath
+	require.Nil(t, cmd.Run())
+	err = T.LocalRepo.CommitAll("add submodule")
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// clone and update submodules
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.UpdateSubmodules(vcs.WithSubmoduleDepth(1))
+	require.Nil(t, err)
+
+	// validate
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, "sub", T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, "2", string(data))
+	subClient, err := vcs.NewGitClient(vcs.WithPath(path.Join(T.FsRepoPath, "sub")))
+	require.Nil(t, err)
+	logs, err := subClient.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+}
+
+func TestCloneBareGitRepo(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// clone bare
+	c, err := vcs.CloneBareGitRepo(T.FsRepoPath, T.RemoteRepoPath)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// no worktree files
+	_, err = os.Stat(path.Join(T.FsRepoPath, T.InitialReadmeFileContent))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(T.FsRepoPath, git.GitDirName))
+	require.True(t, os.IsNotExist(err))
+
+	// logs
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, T.InitialCommitMessage, logs[0].Msg)
+
+	// worktree operations rejected
+	err = c.CommitAll(T.TestCommitMessage)
+	require.ErrorIs(t, err, git.ErrIsBareRepository)
+	_, err = c.GetStatus()
+	require.ErrorIs(t, err, git.ErrIsBareRepository)
+}
+
+func TestGitClient_GetDiffHunks(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// file with ten lines
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	err = ioutil.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	fromHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// change a single line
+	lines[4] = "line five"
+	err = ioutil.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	toHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// hunks
+	hunks, err := T.LocalRepo.GetDiffHunks(fromHash, toHash, T.TestFileName)
+	require.Nil(t, err)
+	require.Len(t, hunks, 1)
+	h := hunks[0]
+	require.Equal(t, 2, h.OldStart)
+	require.Equal(t, 7, h.OldLines)
+	require.Equal(t, 2, h.NewStart)
+	require.Equal(t, 7, h.NewLines)
+	require.Equal(t, []vcs.GitDiffLine{
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 2"},
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 3"},
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 4"},
+		{Type: vcs.GitDiffLineTypeDelete, Content: "line 5"},
+		{Type: vcs.GitDiffLineTypeAdd, Content: "line five"},
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 6"},
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 7"},
+		{Type: vcs.GitDiffLineTypeContext, Content: "line 8"},
+	}, h.Lines)
+
+	// new file
+	hunks, err = T.LocalRepo.GetDiffHunks("", fromHash, T.TestFileName)
+	require.Nil(t, err)
+	require.Len(t, hunks, 1)
+	require.Equal(t, 0, hunks[0].OldStart)
+	require.Equal(t, 0, hunks[0].OldLines)
+	require.Equal(t, 1, hunks[0].NewStart)
+	require.Equal(t, 10, hunks[0].NewLines)
+}
+
+func TestGitClient_WithRef(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// second commit
+	initialHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// run at the initial commit
+	err = T.LocalRepo.WithRef(initialHash, func() error {
+		_, err := os.Stat(filePath)
+		require.True(t, os.IsNotExist(err))
+		hash, err := T.LocalRepo.GetHeadHash()
+		require.Nil(t, err)
+		require.Equal(t, initialHash, hash)
+		return nil
+	})
+	require.Nil(t, err)
+	hash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, hash)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	_, err = os.Stat(filePath)
+	require.Nil(t, err)
+
+	// fn returns an error
+	fnErr := fmt.Errorf("fn error")
+	err = T.LocalRepo.WithRef(initialHash, func() error {
+		return fnErr
+	})
+	require.Equal(t, fnErr, err)
+	hash, err = T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, hash)
+	branch, err = T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+
+	// dirty worktree
+	err = ioutil.WriteFile(filePath, []byte(T.TestBranchName), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.WithRef(initialHash, func() error {
+		return nil
+	})
+	require.ErrorIs(t, err, vcs.ErrWorktreeNotClean)
+}
+
+func TestGitClient_GetConfigScoped(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// global config
+	homePath, err := filepath.Abs(path.Join(path.Dir(T.RemoteRepoPath), "test_home"))
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(homePath, os.FileMode(0766)))
+	defer os.RemoveAll(homePath)
+	err = ioutil.WriteFile(path.Join(homePath, ".gitconfig"), []byte("[user]\n\temail = global@crawlab.cn\n"), os.FileMode(0644))
+	require.Nil(t, err)
+	t.Setenv("HOME", homePath)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	// local config
+	r := T.LocalRepo.GetRepository()
+	cfg, err := r.Config()
+	require.Nil(t, err)
+	cfg.Raw.Section("user").SetOption("email", "local@crawlab.cn")
+	require.Nil(t, r.SetConfig(cfg))
+
+	// local scope
+	value, err := T.LocalRepo.GetConfigScoped(config.LocalScope, "user", "email")
+	require.Nil(t, err)
+	require.Equal(t, "local@crawlab.cn", value)
+	value, err = T.LocalRepo.GetConfig("user", "email")
+	require.Nil(t, err)
+	require.Equal(t, "local@crawlab.cn", value)
+	value, err = T.LocalRepo.GetConfig("remote.origin", "url")
+	require.Nil(t, err)
+	require.Equal(t, T.RemoteRepoPath, value)
+
+	// global scope
+	value, err = T.LocalRepo.GetConfigScoped(config.GlobalScope, "user", "email")
+	require.Nil(t, err)
+	require.Equal(t, "global@crawlab.cn", value)
+
+	// not found
+	_, err = T.LocalRepo.GetConfigScoped(config.GlobalScope, "user", "name")
+	require.ErrorIs(t, err, vcs.ErrConfigNotFound)
+}
+
+func TestGitClient_WithAutoCRLF(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithAutoCRLF(vcs.GitAutoCRLFInput),
+	)
+	require.Nil(t, err)
+	value, err := c.GetConfig("core", "autocrlf")
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitAutoCRLFInput, value)
+
+	// commit crlf file
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte("line 1\r\nline 2\r\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// validate
+	data, err := c.GetFileContentAtRef(T.TestFileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "line 1\nline 2\n", string(data))
+	data, err = ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, "line 1\r\nline 2\r\n", string(data))
+
+	// worktree matches the index after the commit
+	statusList, err := c.GetStatus()
+	require.Nil(t, err)
+	require.Empty(t, statusList)
+	headHash, err := c.GetHeadHash()
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.ErrorIs(t, err, git.ErrEmptyCommit)
+	hash, err := c.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, hash)
+
+	// commit modified crlf file with the all option
+	err = ioutil.WriteFile(filePath, []byte("line 1\r\nline 2\r\nline 3\r\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.Commit(T.TestCommitMessage, vcs.WithAll(true))
+	require.Nil(t, err)
+	data, err = c.GetFileContentAtRef(T.TestFileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "line 1\nline 2\nline 3\n", string(data))
+}
+
+func TestGitClient_ListRecoverablePoints(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// nothing lost
+	points, err := T.LocalRepo.ListRecoverablePoints()
+	require.Nil(t, err)
+	require.Len(t, points, 0)
+
+	// commit
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("original commit")
+	require.Nil(t, err)
+	originalHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// amend (soft reset to the parent and commit again)
+	r := T.LocalRepo.GetRepository()
+	commit, err := r.CommitObject(plumbing.NewHash(originalHash))
+	require.Nil(t, err)
+	err = T.LocalRepo.Reset(vcs.WithCommit(commit.ParentHashes[0]), vcs.WithMode(git.SoftReset))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("amended commit")
+	require.Nil(t, err)
+
+	// validate
+	points, err = T.LocalRepo.ListRecoverablePoints()
+	require.Nil(t, err)
+	require.Len(t, points, 1)
+	require.Equal(t, originalHash, points[0].Hash)
+	require.Equal(t, "original commit", points[0].Msg)
+	require.False(t, points[0].Timestamp.IsZero())
+}
+
+func TestGitClient_PreviewReset(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	initialHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// uncommitted changes
+	err = ioutil.WriteFile(filePath, []byte(T.TestBranchName), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "untracked.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+
+	// preview hard reset
+	lostCommits, lostFiles, err := T.LocalRepo.PreviewReset(initialHash, git.HardReset)
+	require.Nil(t, err)
+	require.Len(t, lostCommits, 1)
+	require.Equal(t, headHash, lostCommits[0].Hash)
+	require.Equal(t, []string{T.TestFileName, "untracked.txt"}, lostFiles)
+
+	// preview soft reset
+	_, lostFiles, err = T.LocalRepo.PreviewReset(initialHash, git.SoftReset)
+	require.Nil(t, err)
+	require.Equal(t, []string{"untracked.txt"}, lostFiles)
+
+	// commit still reachable from another branch
+	r := T.LocalRepo.GetRepository()
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(T.TestBranchName), plumbing.NewHash(headHash)))
+	require.Nil(t, err)
+	lostCommits, _, err = T.LocalRepo.PreviewReset(initialHash, git.HardReset)
+	require.Nil(t, err)
+	require.Len(t, lostCommits, 0)
+
+	// nothing was reset
+	hash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, hash)
+	data, err := ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, T.TestBranchName, string(data))
+}
+
+func TestGitClient_GetUpstreamUrl(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// no upstream
+	_, _, err = T.LocalRepo.GetUpstreamUrl(vcs.GitBranchNameMaster)
+	require.ErrorIs(t, err, vcs.ErrNoUpstream)
+
+	// set upstream
+	upstreamUrl := "https://github.com/crawlab-team/upstream.git"
+	err = T.LocalRepo.AddRemote("upstream", upstreamUrl)
+	require.Nil(t, err)
+	err = T.LocalRepo.SetUpstream(vcs.GitBranchNameMaster, "upstream")
+	require.Nil(t, err)
+
+	// validate
+	remoteName, url, err := T.LocalRepo.GetUpstreamUrl(vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.Equal(t, "upstream", remoteName)
+	require.Equal(t, upstreamUrl, url)
+	remoteName, url, err = T.LocalRepo.GetUpstreamUrl("")
+	require.Nil(t, err)
+	require.Equal(t, "upstream", remoteName)
+	require.Equal(t, upstreamUrl, url)
+
+	// switch to origin
+	err = T.LocalRepo.SetUpstream(vcs.GitBranchNameMaster, vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	remoteName, url, err = T.LocalRepo.GetUpstreamUrl(vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRemoteNameOrigin, remoteName)
+	require.Equal(t, T.RemoteRepoPath, url)
+}
+
+func TestGitClient_FetchWithProgress(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit files and push
+	for i := 0; i < 20; i++ {
+		filePath := path.Join(T.LocalRepoPath, fmt.Sprintf("test-%d.txt", i))
+		err = ioutil.WriteFile(filePath, []byte(fmt.Sprintf("%d", i)), os.FileMode(0766))
+		require.Nil(t, err)
+	}
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git client
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithNoAutoRemote(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.AddRemote(vcs.GitRemoteNameOrigin, T.RemoteRepoPath)
+	require.Nil(t, err)
+
+	// fetch with progress
+	var progresses []vcs.GitProgress
+	err = c.Fetch(vcs.WithProgressFetch(func(p vcs.GitProgress) {
+		progresses = append(progresses, p)
+	}))
+	require.Nil(t, err)
+
+	// validate
+	var counting *vcs.GitProgress
+	for i, p := range progresses {
+		require.NotEmpty(t, p.Stage)
+		require.LessOrEqual(t, p.Current, p.Total)
+		if p.Stage == "Counting objects" && p.Done {
+			counting = &progresses[i]
+		}
+	}
+	require.NotNil(t, counting)
+	require.Equal(t, 100, counting.Percent)
+	require.Greater(t, counting.Total, 20)
+}
+
+func TestGitClient_CheckoutRef(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// refs
+	initialHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	r := T.LocalRepo.GetRepository()
+	_, err = r.CreateTag("v0.0.1", plumbing.NewHash(initialHash), &git.CreateTagOptions{
+		Message: "v0.0.1",
+		Tagger:  &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()},
+	})
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	developHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// resolve
+	ref, err := T.LocalRepo.ResolveRef("v0.0.1")
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRefTypeTag, ref.Type)
+	require.Equal(t, initialHash, ref.Hash)
+	ref, err = T.LocalRepo.ResolveRef(initialHash)
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRefTypeCommit, ref.Type)
+
+	// branch
+	err = T.LocalRepo.CheckoutRef(vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	err = T.LocalRepo.CheckoutRef(T.TestBranchName)
+	require.Nil(t, err)
+	branch, err = T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, T.TestBranchName, branch)
+	hash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, developHash, hash)
+
+	// tag
+	err = T.LocalRepo.CheckoutRef("v0.0.1")
+	require.Nil(t, err)
+	headRef, err := r.Reference(plumbing.HEAD, false)
+	require.Nil(t, err)
+	require.Equal(t, plumbing.HashReference, headRef.Type())
+	require.Equal(t, initialHash, headRef.Hash().String())
+	_, err = os.Stat(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.True(t, os.IsNotExist(err))
+
+	// hash
+	err = T.LocalRepo.CheckoutRef(developHash)
+	require.Nil(t, err)
+	headRef, err = r.Reference(plumbing.HEAD, false)
+	require.Nil(t, err)
+	require.Equal(t, plumbing.HashReference, headRef.Type())
+	require.Equal(t, developHash, headRef.Hash().String())
+}
+
+func TestGitClient_GetRepoState(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// clean
+	state, err := T.LocalRepo.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateClean, state)
+
+	// conflicted
+	T.CreateConflict(t)
+	state, err = T.LocalRepo.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateConflicted, state)
+
+	// merging
+	err = T.LocalRepo.ResolveConflict(T.ConflictFileName, []byte("resolved\n"))
+	require.Nil(t, err)
+	state, err = T.LocalRepo.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateMerging, state)
+
+	// clean
+	err = T.LocalRepo.ContinueMerge("")
+	require.Nil(t, err)
+	state, err = T.LocalRepo.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateClean, state)
+
+	// rebasing
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, git.GitDirName, vcs.GitRebaseMerge), os.FileMode(0766))
+	require.Nil(t, err)
+	state, err = T.LocalRepo.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateRebasing, state)
+}
+
+func TestGitClient_PullWithConflictStrategy(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// base
+	conflictFilePath := path.Join(T.LocalRepoPath, T.ConflictFileName)
+	err = ioutil.WriteFile(conflictFilePath, []byte("base\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	linesFilePath := path.Join(T.LocalRepoPath, "lines.txt")
+	err = ioutil.WriteFile(linesFilePath, []byte("1\n2\n3\n4\n5\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("base")
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// theirs
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = ioutil.WriteFile(path.Join(T.FsRepoPath, T.ConflictFileName), []byte("theirs\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.FsRepoPath, "theirs.txt"), []byte("theirs\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.FsRepoPath, "lines.txt"), []byte("one\n2\ntheirs\n4\n5\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll("theirs")
+	require.Nil(t, err)
+	err = c.Push()
+	require.Nil(t, err)
+	theirsHash, err := c.GetHeadHash()
+	require.Nil(t, err)
+
+	// ours
+	err = ioutil.WriteFile(conflictFilePath, []byte("ours\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "ours.txt"), []byte("ours\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(linesFilePath, []byte("1\n2\nours\n4\nfive\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("ours")
+	require.Nil(t, err)
+	oursHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// pull with theirs strategy
+	err = T.LocalRepo.Pull(
+		vcs.WithBranchNamePull(vcs.GitBranchNameMaster),
+		vcs.WithConflictStrategy(vcs.GitConflictStrategyTheirs),
+	)
+	require.Nil(t, err)
+
+	// validate
+	data, err := ioutil.ReadFile(conflictFilePath)
+	require.Nil(t, err)
+	require.Equal(t, "theirs\n", string(data))
+	data, err = ioutil.ReadFile(linesFilePath)
+	require.Nil(t, err)
+	require.Equal(t, "one\n2\ntheirs\n4\nfive\n", string(data))
+	for _, fileName := range []string{"ours.txt", "theirs.txt"} {
+		_, err = os.Stat(path.Join(T.LocalRepoPath, fileName))
+		require.Nil(t, err)
+	}
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	commit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	require.Equal(t, []plumbing.Hash{plumbing.NewHash(oursHash), plumbing.NewHash(theirsHash)}, commit.ParentHashes)
+	content, err := T.LocalRepo.GetFileContentAtRef(T.ConflictFileName, "HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "theirs\n", string(content))
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+}
+
+func TestGitClient_GetLogsJSON(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// json
+	data, err := T.LocalRepo.GetLogsJSON()
+	require.Nil(t, err)
+	var logs []vcs.GitLog
+	err = json.Unmarshal(data, &logs)
+	require.Nil(t, err)
+
+	// validate
+	expected, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	for i := range logs {
+		require.Equal(t, expected[i].Hash, logs[i].Hash)
+		require.Equal(t, expected[i].Msg, logs[i].Msg)
+		require.Equal(t, expected[i].ParentHashes, logs[i].ParentHashes)
+		require.True(t, expected[i].Timestamp.Equal(logs[i].Timestamp))
+	}
+	require.Equal(t, []string{logs[1].Hash}, logs[0].ParentHashes)
+	require.Len(t, logs[1].ParentHashes, 0)
+
+	// options
+	data, err = T.LocalRepo.GetLogsJSON(vcs.WithFromLog(logs[1].Hash))
+	require.Nil(t, err)
+	logs = nil
+	err = json.Unmarshal(data, &logs)
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+}
+
+func TestSetSSHMaxConnectionsPerHost(t *testing.T) {
+	var err error
+	T.Setup(t)
+	vcs.SetSSHMaxConnectionsPerHost(1)
+	defer vcs.SetSSHMaxConnectionsPerHost(0)
+
+	// server holding each connection for a while without speaking ssh
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	var mu sync.Mutex
+	var active, maxActive, total int
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				mu.Lock()
+				active++
+				total++
+				if active > maxActive {
+					maxActive = active
+				}
+				mu.Unlock()
+				time.Sleep(300 * time.Millisecond)
+				mu.Lock()
+				active--
+				mu.Unlock()
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	// private key
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	// concurrent fetches and pushes to the same host, by remote and by explicit url
+	remoteUrl := fmt.Sprintf("ssh://git@%s/test.git", l.Addr().String())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		c, err := vcs.NewGitClient(
+			vcs.WithPath(fmt.Sprintf("%s_%d", T.FsRepoPath, i)),
+			vcs.WithNoAutoRemote(true),
+			vcs.WithAuthType(vcs.GitAuthTypeSSH),
+			vcs.WithPrivateKey(string(privateKey)),
+		)
+		require.Nil(t, err)
+		defer c.Dispose()
+		switch i {
+		case 0:
+			err = c.AddRemote(vcs.GitRemoteNameOrigin, remoteUrl)
+		default:
+			err = c.AddRemote(vcs.GitRemoteNameOrigin, T.RemoteRepoPath)
+		}
+		require.Nil(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i {
+			case 0:
+				_ = c.Fetch()
+			case 1, 2:
+				_ = c.Fetch(vcs.WithRemoteURLFetch(remoteUrl))
+			default:
+				_ = c.Push(vcs.WithRemoteURLPush(remoteUrl))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// validate
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 4, total)
+	require.Equal(t, 1, maxActive)
+}
+
+func TestGitClient_CommitTree(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// bare repo
+	c, err := vcs.NewGitClient(vcs.WithPath(T.RemoteRepoPath))
+	require.Nil(t, err)
+	r := c.GetRepository()
+	parentHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// blob and tree
+	blob := r.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	require.Nil(t, err)
+	_, err = w.Write([]byte(T.TestFileContent))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	blobHash, err := r.Storer.SetEncodedObject(blob)
+	require.Nil(t, err)
+	tree := &object.Tree{Entries: []object.TreeEntry{
+		{Name: T.TestFileName, Mode: filemode.Regular, Hash: blobHash},
+	}}
+	treeObj := r.Storer.NewEncodedObject()
+	require.Nil(t, tree.Encode(treeObj))
+	treeHash, err := r.Storer.SetEncodedObject(treeObj)
+	require.Nil(t, err)
+
+	// commit tree
+	author := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()}
+	hash, err := c.CommitTree(treeHash.String(), []string{parentHash}, "generated", author)
+	require.Nil(t, err)
+
+	// validate
+	l, err := c.GetCommit(hash)
+	require.Nil(t, err)
+	require.Equal(t, hash, l.Hash)
+	require.Equal(t, "generated", l.Msg)
+	require.Equal(t, "crawlab", l.AuthorName)
+	require.Equal(t, []string{parentHash}, l.ParentHashes)
+	content, err := c.GetFileContentAtRef(T.TestFileName, hash)
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(content))
+
+	// refs untouched
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	require.Equal(t, parentHash, headRef.Hash().String())
+}
+
+func TestGitClient_GetRootCommits(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// linear
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	roots, err := T.LocalRepo.GetRootCommits()
+	require.Nil(t, err)
+	require.Len(t, roots, 1)
+	require.Equal(t, T.InitialCommitMessage, roots[0].Msg)
+
+	// unrelated history
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	headCommit, err := T.LocalRepo.GetRepository().CommitObject(plumbing.NewHash(headHash))
+	require.Nil(t, err)
+	author := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()}
+	orphanHash, err := T.LocalRepo.CommitTree(headCommit.TreeHash.String(), nil, "unrelated root", author)
+	require.Nil(t, err)
+
+	// merge
+	err = T.LocalRepo.Commit("merge unrelated history", vcs.WithParents([]plumbing.Hash{
+		plumbing.NewHash(headHash),
+		plumbing.NewHash(orphanHash),
+	}))
+	require.Nil(t, err)
+
+	// validate
+	roots, err = T.LocalRepo.GetRootCommits()
+	require.Nil(t, err)
+	require.Len(t, roots, 2)
+	var msgs []string
+	for _, l := range roots {
+		msgs = append(msgs, l.Msg)
+	}
+	require.ElementsMatch(t, []string{T.InitialCommitMessage, "unrelated root"}, msgs)
+}
+
+func TestGitClient_WithObjectCache(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits
+	for i := 0; i < 5; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(fmt.Sprintf("%s %d", T.TestFileContent, i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("%s %d", T.TestCommitMessage, i))
+		require.Nil(t, err)
+	}
+
+	// client with object cache
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithObjectCache(16*cache.MiByte),
+	)
+	require.Nil(t, err)
+
+	// identical results
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	cachedLogs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Equal(t, logs, cachedLogs)
+	require.Equal(t, vcs.GitObjectCacheStats{}, T.LocalRepo.GetObjectCacheStats())
+
+	// repeated walk is served from the cache
+	stats := c.GetObjectCacheStats()
+	require.Greater(t, stats.Misses, int64(0))
+	cachedLogs, err = c.GetLogs()
+	require.Nil(t, err)
+	require.Equal(t, logs, cachedLogs)
+	require.Less(t, c.GetObjectCacheStats().Misses-stats.Misses, stats.Misses)
+	require.Greater(t, c.GetObjectCacheStats().Hits, stats.Hits)
+}
+
+func TestGitClient_WithObjectCache_FsRepo(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// hooks disabled on init
+	hooksPath := path.Join(T.LocalRepoPath, git.GitDirName, vcs.GitHooksDirName)
+	err = os.MkdirAll(hooksPath, os.FileMode(0755))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(hooksPath, "pre-commit"), []byte("#!/bin/sh\nexit 1\n"), os.FileMode(0755))
+	require.Nil(t, err)
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithObjectCache(cache.MiByte),
+		vcs.WithDisableHooks(true),
+	)
+	require.Nil(t, err)
+	_, err = os.Stat(path.Join(hooksPath, "pre-commit"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(hooksPath, "pre-commit"+vcs.GitHookSampleSuffix))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(hooksPath, "post-merge"), []byte("#!/bin/sh\nexit 0\n"), os.FileMode(0755))
+	require.Nil(t, err)
+	hooks, err := c.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 1)
+	require.Equal(t, "post-merge", hooks[0].Name)
+	require.Nil(t, c.RemoveHooks())
+
+	// description and maintenance info
+	err = c.SetDescription("crawlab spider repo")
+	require.Nil(t, err)
+	desc, err := c.GetDescription()
+	require.Nil(t, err)
+	require.Equal(t, "crawlab spider repo", desc)
+	_, err = c.GetMaintenanceInfo()
+	require.Nil(t, err)
+
+	// merge state
+	T.CreateConflict(t)
+	state, err := c.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateConflicted, state)
+	err = c.ResolveConflict(T.ConflictFileName, []byte("resolved\n"))
+	require.Nil(t, err)
+	state, err = c.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateMerging, state)
+	err = c.ContinueMerge("")
+	require.Nil(t, err)
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Contains(t, logs[0].Msg, T.TestBranchName)
+	state, err = c.GetRepoState()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitRepoStateClean, state)
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		_, err = os.Stat(path.Join(T.LocalRepoPath, git.GitDirName, name))
+		require.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func BenchmarkGitClient_WithObjectCache(b *testing.B) {
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(path.Join(b.TempDir(), "repo")),
+		vcs.WithObjectCache(16*cache.MiByte),
+	)
+	require.Nil(b, err)
+	defer c.Dispose()
+	for i := 0; i < 50; i++ {
+		err = ioutil.WriteFile(path.Join(c.GetPath(), "file.txt"), []byte(fmt.Sprintf("content %d", i)), os.FileMode(0766))
+		require.Nil(b, err)
+		err = c.CommitAll(fmt.Sprintf("commit %d", i))
+		require.Nil(b, err)
+	}
+
+	// lookups are what a client without cache reads from the storage
+	b.ResetTimer()
+	start := c.GetObjectCacheStats()
+	for i := 0; i < b.N; i++ {
+		_, err := c.GetLogs()
+		require.Nil(b, err)
+	}
+	stats := c.GetObjectCacheStats()
+	hits, misses := stats.Hits-start.Hits, stats.Misses-start.Misses
+	b.ReportMetric(float64(hits+misses)/float64(b.N), "lookups/op")
+	b.ReportMetric(float64(misses)/float64(b.N), "reads/op")
+}
+
+func TestGitClient_IsRemoteRewritten(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	baseHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// worker
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// fast-forward
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	ok, err := c.IsRemoteRewritten(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// rewrite history and force push
+	err = T.LocalRepo.Reset(vcs.WithCommit(plumbing.NewHash(baseHash)), vcs.WithMode(git.HardReset))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte("rewritten"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("rewritten commit")
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithForcePush(true))
+	require.Nil(t, err)
+
+	// validate
+	ok, err = c.IsRemoteRewritten(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// up to date after detection
+	ok, err = c.IsRemoteRewritten(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestGitClient_WithAllowEmpty(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client without files
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// empty commit is rejected by default
+	err = c.Commit("deploy point")
+	require.ErrorIs(t, err, git.ErrEmptyCommit)
+
+	// empty commits allowed
+	err = c.Commit("deploy point 1", vcs.WithAllowEmpty(true))
+	require.Nil(t, err)
+	err = c.Commit("deploy point 2", vcs.WithAllowEmpty(true))
+	require.Nil(t, err)
+
+	// validate
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	headHash, err := c.GetHeadHash()
+	require.Nil(t, err)
+	head, err := c.GetRepository().CommitObject(plumbing.NewHash(headHash))
+	require.Nil(t, err)
+	parent, err := head.Parent(0)
+	require.Nil(t, err)
+	require.Equal(t, parent.TreeHash, head.TreeHash)
+
+	// clean worktree with a non-empty index is rejected by default
+	err = T.LocalRepo.Commit("no change")
+	require.ErrorIs(t, err, git.ErrEmptyCommit)
+	err = T.LocalRepo.CommitAll("no change")
+	require.ErrorIs(t, err, git.ErrEmptyCommit)
+	logs, err = T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+
+	// and allowed with the option
+	err = T.LocalRepo.Commit("deploy point", vcs.WithAllowEmpty(true))
+	require.Nil(t, err)
+	logs, err = T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, "deploy point", logs[0].Msg)
+}
+
+func TestGitClient_GetDiffModeChange(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit script
+	filePath := path.Join(T.LocalRepoPath, "main.sh")
+	err = ioutil.WriteFile(filePath, []byte("echo it works\n"), os.FileMode(0644))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("add script")
+	require.Nil(t, err)
+	fromHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// chmod +x
+	err = os.Chmod(filePath, os.FileMode(0755))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("make script executable")
+	require.Nil(t, err)
+	toHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// validate
+	files, err := T.LocalRepo.GetDiff(fromHash, toHash)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "main.sh", files[0].Path)
+	require.Equal(t, vcs.GitDiffStatusModified, files[0].Status)
+	require.Equal(t, "100644", files[0].OldMode)
+	require.Equal(t, "100755", files[0].NewMode)
+	require.True(t, files[0].ModeChanged)
+	require.Len(t, files[0].Hunks, 0)
+
+	// added file has no mode change
+	files, err = T.LocalRepo.GetDiff("", fromHash)
+	require.Nil(t, err)
+	for _, f := range files {
+		require.Equal(t, vcs.GitDiffStatusAdded, f.Status)
+		require.Empty(t, f.OldMode)
+		require.False(t, f.ModeChanged)
+	}
+}
+
+func TestGitClient_GetStatusForPath(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// files inside and outside the prefix
+	for _, dir := range []string{"spider_a", "spider_a_backup", "spider_b"} {
+		err = os.MkdirAll(path.Join(T.LocalRepoPath, dir), os.FileMode(0766))
+		require.Nil(t, err)
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, dir, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+	}
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "spider_a", "main.py"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+
+	// validate
+	for _, prefix := range []string{"spider_a", "spider_a/", "./spider_a"} {
+		status, err := T.LocalRepo.GetStatusForPath(prefix)
+		require.Nil(t, err)
+		require.Len(t, status, 2)
+		require.Equal(t, "spider_a/main.py", status[0].Path)
+		require.Equal(t, "spider_a/"+T.TestFileName, status[1].Path)
+	}
+
+	// empty prefix returns the whole tree
+	status, err := T.LocalRepo.GetStatusForPath("")
+	require.Nil(t, err)
+	require.Len(t, status, 4)
+}
+
+func TestGitClient_VerifyTag(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// keys
+	entity, err := openpgp.NewEntity("test", "", "test@crawlab.cn", nil)
+	require.Nil(t, err)
+	otherEntity, err := openpgp.NewEntity("other", "", "other@crawlab.cn", nil)
+	require.Nil(t, err)
+
+	// tags
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	tagger := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()}
+	_, err = r.CreateTag("v1.0.0", headRef.Hash(), &git.CreateTagOptions{
+		Tagger:  tagger,
+		Message: "signed release",
+		SignKey: entity,
+	})
+	require.Nil(t, err)
+	_, err = r.CreateTag("v0.9.0", headRef.Hash(), &git.CreateTagOptions{
+		Tagger:  tagger,
+		Message: "unsigned release",
+	})
+	require.Nil(t, err)
+	_, err = r.CreateTag("lightweight", headRef.Hash(), nil)
+	require.Nil(t, err)
+
+	// signed
+	signer, err := T.LocalRepo.VerifyTag("v1.0.0", openpgp.EntityList{entity})
+	require.Nil(t, err)
+	require.Equal(t, entity.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+
+	// wrong keyring
+	_, err = T.LocalRepo.VerifyTag("v1.0.0", openpgp.EntityList{otherEntity})
+	require.NotNil(t, err)
+
+	// unsigned and lightweight
+	_, err = T.LocalRepo.VerifyTag("v0.9.0", openpgp.EntityList{entity})
+	require.ErrorIs(t, err, vcs.ErrTagNotSigned)
+	_, err = T.LocalRepo.VerifyTag("lightweight", openpgp.EntityList{entity})
+	require.ErrorIs(t, err, vcs.ErrTagNotAnnotated)
+}
+
+func TestGitClient_WithFollowSymlinks(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// symlinked repo path
+	targetPath := T.FsRepoPath
+	linkPath := T.FsRepoPath + "_link"
+	err = os.MkdirAll(targetPath, os.FileMode(0766))
+	require.Nil(t, err)
+	defer os.RemoveAll(targetPath)
+	err = os.Symlink(filepath.Base(targetPath), linkPath)
+	require.Nil(t, err)
+	defer os.Remove(linkPath)
+
+	// init through the link
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(linkPath),
+	)
+	require.Nil(t, err)
+	require.Equal(t, linkPath, c.GetPath())
+	_, err = os.Stat(path.Join(targetPath, git.GitDirName))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(linkPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// dispose removes the link only by default
+	err = c.Dispose()
+	require.Nil(t, err)
+	_, err = os.Lstat(linkPath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(targetPath, T.TestFileName))
+	require.Nil(t, err)
+
+	// reopen through a new link
+	err = os.Symlink(filepath.Base(targetPath), linkPath)
+	require.Nil(t, err)
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(linkPath),
+		vcs.WithFollowSymlinks(true),
+	)
+	require.Nil(t, err)
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+
+	// dispose removes the link and its target
+	err = c.Dispose()
+	require.Nil(t, err)
+	_, err = os.Lstat(linkPath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(targetPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGitClient_PruneRemote(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push and fetch
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = T.LocalRepo.Fetch()
+	require.Nil(t, err)
+
+	// stale remote-tracking branch
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	staleRefName := plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, T.TestBranchName)
+	err = r.Storer.SetReference(plumbing.NewHashReference(staleRefName, headRef.Hash()))
+	require.Nil(t, err)
+
+	// prune
+	pruned, err := T.LocalRepo.PruneRemote("")
+	require.Nil(t, err)
+	require.Equal(t, []string{vcs.GitRemoteNameOrigin + "/" + T.TestBranchName}, pruned)
+
+	// validate
+	_, err = r.Reference(staleRefName, false)
+	require.Equal(t, plumbing.ErrReferenceNotFound, err)
+	_, err = r.Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), false)
+	require.Nil(t, err)
+
+	// nothing left to prune
+	pruned, err = T.LocalRepo.PruneRemote(vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	require.Len(t, pruned, 0)
+}
+
+func TestGitClient_WithKeepHead(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// develop branch with a commit
+	masterHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName)
+	require.Nil(t, err)
+	filePath := path.Join(T.LocalRepoPath, T.TestFileName)
+	err = ioutil.WriteFile(filePath, []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	developHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = T.LocalRepo.Checkout(vcs.WithBranch(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+	_, err = os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+
+	// branch checkout keeping HEAD
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName, vcs.WithKeepHead(true))
+	require.Nil(t, err)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, masterHash, headHash)
+	data, err := ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 1)
+	require.Equal(t, T.TestFileName, status[0].Path)
+	require.NotEqual(t, status[0].Staging, status[0].Worktree)
+
+	// back to master
+	err = T.LocalRepo.Reset(vcs.WithMode(git.HardReset))
+	require.Nil(t, err)
+	_, err = os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+
+	// hash checkout keeping HEAD
+	err = T.LocalRepo.CheckoutHash(developHash, vcs.WithKeepHead(true))
+	require.Nil(t, err)
+	branch, err = T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	headHash, err = T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, masterHash, headHash)
+	data, err = ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// hash checkout without keeping HEAD detaches it
+	err = T.LocalRepo.Reset(vcs.WithMode(git.HardReset))
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutHash(developHash)
+	require.Nil(t, err)
+	headRef, err := T.LocalRepo.GetRepository().Storer.Reference(plumbing.HEAD)
+	require.Nil(t, err)
+	require.Equal(t, plumbing.HashReference, headRef.Type())
+	require.Equal(t, developHash, headRef.Hash().String())
+}
+
+func TestGitClient_ConcurrentInit(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// push initial commit
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// init the same path concurrently
+	n := 64
+	clients := make([]*vcs.GitClient, n)
+	errs := make([]error, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = vcs.NewGitClient(
+				vcs.WithPath(T.FsRepoPath),
+				vcs.WithRemoteUrl(T.RemoteRepoPath),
+			)
+		}(i)
+	}
+	wg.Wait()
+	defer clients[0].Dispose()
+
+	// validate
+	for i := 0; i < n; i++ {
+		require.Nil(t, errs[i])
+	}
+	r, err := git.PlainOpen(T.FsRepoPath)
+	require.Nil(t, err)
+	remotes, err := r.Remotes()
+	require.Nil(t, err)
+	require.Len(t, remotes, 1)
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	localHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, localHash, headRef.Hash().String())
+}
+
+func TestGitClient_CreateBundle(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// second commit
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// bundle
+	bundlePath, err := filepath.Abs(path.Join(T.LocalRepoPath, "..", "test_repo.bundle"))
+	require.Nil(t, err)
+	defer os.Remove(bundlePath)
+	err = T.LocalRepo.CreateBundle(bundlePath, nil)
+	require.Nil(t, err)
+	out, err := exec.Command("git", "-C", T.LocalRepoPath, "bundle", "verify", bundlePath).CombinedOutput()
+	require.Nil(t, err, string(out))
+
+	// open from bundle
+	c, err := vcs.OpenFromBundle(bundlePath, T.FsRepoPath)
+	require.Nil(t, err)
+	defer c.Dispose()
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	branch, err := c.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	bundleHeadHash, err := c.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, bundleHeadHash)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+	status, err := c.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+
+	// bundle created by git
+	err = c.Dispose()
+	require.Nil(t, err)
+	out, err = exec.Command("git", "-C", T.LocalRepoPath, "bundle", "create", bundlePath, vcs.GitBranchNameMaster).CombinedOutput()
+	require.Nil(t, err, string(out))
+	c, err = vcs.OpenFromBundle(bundlePath, T.FsRepoPath)
+	require.Nil(t, err)
+	bundleHeadHash, err = c.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, bundleHeadHash)
+
+	// invalid bundle
+	err = ioutil.WriteFile(bundlePath, []byte("not a bundle"), os.FileMode(0644))
+	require.Nil(t, err)
+	_, err = vcs.OpenFromBundle(bundlePath, T.FsRepoPath)
+	require.ErrorIs(t, err, vcs.ErrInvalidBundle)
+}
+
+func TestGitClient_GetWorktreeChanges(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit files
+	for _, name := range []string{"modified.txt", "deleted.txt"} {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, name), []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+	}
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// changes
+	start := time.Now().Add(-time.Second)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "added.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "modified.txt"), []byte("modified"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = os.Remove(path.Join(T.LocalRepoPath, "deleted.txt"))
+	require.Nil(t, err)
+
+	// validate
+	changes, err := T.LocalRepo.GetWorktreeChanges()
+	require.Nil(t, err)
+	require.Len(t, changes, 3)
+	require.Equal(t, "added.txt", changes[0].Path)
+	require.Equal(t, vcs.GitDiffStatusAdded, changes[0].Status)
+	require.Equal(t, "deleted.txt", changes[1].Path)
+	require.Equal(t, vcs.GitDiffStatusDeleted, changes[1].Status)
+	require.True(t, changes[1].ModTime.IsZero())
+	require.Equal(t, "modified.txt", changes[2].Path)
+	require.Equal(t, vcs.GitDiffStatusModified, changes[2].Status)
+	for _, change := range []vcs.GitWorktreeChange{changes[0], changes[2]} {
+		require.True(t, change.ModTime.After(start))
+		require.False(t, change.ModTime.After(time.Now()))
+	}
+
+	// mem repo
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.WriteMemFile(T.TestFileName, []byte(T.TestFileContent))
+	require.Nil(t, err)
+	changes, err = c.GetWorktreeChanges()
+	require.Nil(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, T.TestFileName, changes[0].Path)
+	require.Equal(t, vcs.GitDiffStatusAdded, changes[0].Status)
+	require.True(t, changes[0].ModTime.After(start))
+}
+
+func TestGitClient_WithMailmap(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits with two emails of the same person
+	for i, email := range []string{"alice@old.example.com", "Alice@Laptop.local"} {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(fmt.Sprintf("%s %d", T.TestFileContent, i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(T.TestCommitMessage, vcs.WithAuthor(&object.Signature{
+			Name:  fmt.Sprintf("alice %d", i),
+			Email: email,
+			When:  time.Now(),
+		}))
+		require.Nil(t, err)
+	}
+
+	// client with mailmap
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithMailmap(map[string]string{
+			"alice@old.example.com": "Alice <alice@crawlab.cn>",
+			"alice@laptop.local":    "Alice <alice@crawlab.cn>",
+		}),
+	)
+	require.Nil(t, err)
+
+	// canonicalized to a single author
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 3)
+	authors := map[string]bool{}
+	for _, l := range logs[:2] {
+		authors[fmt.Sprintf("%s <%s>", l.AuthorName, l.AuthorEmail)] = true
+	}
+	require.Equal(t, map[string]bool{"Alice <alice@crawlab.cn>": true}, authors)
+
+	// history untouched
+	rawLogs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Equal(t, "Alice@Laptop.local", rawLogs[0].AuthorEmail)
+	require.Equal(t, "alice@old.example.com", rawLogs[1].AuthorEmail)
+	for i := range logs {
+		require.Equal(t, rawLogs[i].Hash, logs[i].Hash)
+	}
+}
+
+func TestGitClient_CheckOwnership(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// owned by the current process
+	err = T.LocalRepo.CheckOwnership()
+	require.Nil(t, err)
+
+	// foreign owner
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership is not checked on windows")
+	}
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithOwnerUid(os.Geteuid()+1000),
+	)
+	require.Nil(t, err)
+	err = c.CheckOwnership()
+	require.ErrorIs(t, err, vcs.ErrDubiousOwnership)
+
+	// trusted path
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithOwnerUid(os.Geteuid()+1000),
+		vcs.WithTrustedPath(T.LocalRepoPath),
+	)
+	require.Nil(t, err)
+	err = c.CheckOwnership()
+	require.Nil(t, err)
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithOwnerUid(os.Geteuid()+1000),
+		vcs.WithTrustedPath("*"),
+	)
+	require.Nil(t, err)
+	err = c.CheckOwnership()
+	require.Nil(t, err)
+}
+
+func TestGitClient_GetCommitsBetweenTags(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// v1.0.0 (lightweight) on the initial commit
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	_, err = r.CreateTag("v1.0.0", headRef.Hash(), nil)
+	require.Nil(t, err)
+
+	// commits
+	for i := 0; i < 3; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(fmt.Sprintf("%s %d", T.TestFileContent, i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("%s %d", T.TestCommitMessage, i))
+		require.Nil(t, err)
+	}
+
+	// v1.1.0 (annotated)
+	headRef, err = r.Head()
+	require.Nil(t, err)
+	_, err = r.CreateTag("v1.1.0", headRef.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()},
+		Message: "release v1.1.0",
+	})
+	require.Nil(t, err)
+
+	// commit after the last tag
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("unreleased")
+	require.Nil(t, err)
+
+	// between tags
+	logs, err := T.LocalRepo.GetCommitsBetweenTags("v1.0.0", "v1.1.0")
+	require.Nil(t, err)
+	require.Len(t, logs, 3)
+	for i, l := range logs {
+		require.Equal(t, fmt.Sprintf("%s %d", T.TestCommitMessage, 2-i), l.Msg)
+	}
+
+	// up to a tag
+	logs, err = T.LocalRepo.GetCommitsBetweenTags("", "v1.1.0")
+	require.Nil(t, err)
+	require.Len(t, logs, 4)
+	require.Equal(t, T.InitialCommitMessage, logs[3].Msg)
+
+	// unknown tag
+	_, err = T.LocalRepo.GetCommitsBetweenTags("v1.0.0", "v9.9.9")
+	require.NotNil(t, err)
+}
+
+func TestGitClient_WithFetchRefSpecs(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// pull request ref on the remote
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("proposed change")
+	require.Nil(t, err)
+	prHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithRefSpecs([]config.RefSpec{"refs/heads/master:refs/pull/1/head"}))
+	require.Nil(t, err)
+
+	// worker
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	prRefName := plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, "pr/1")
+	_, err = c.GetRepository().Reference(prRefName, false)
+	require.Equal(t, plumbing.ErrReferenceNotFound, err)
+
+	// fetch pull request refs
+	err = c.Fetch(vcs.WithFetchRefSpecs([]config.RefSpec{"+refs/pull/*/head:refs/remotes/origin/pr/*"}))
+	require.Nil(t, err)
+	ref, err := c.GetRepository().Reference(prRefName, false)
+	require.Nil(t, err)
+	require.Equal(t, prHash, ref.Hash().String())
+
+	// check out the proposed version
+	err = c.CheckoutHash(prHash)
+	require.Nil(t, err)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+}
+
+func TestGitClient_ListHooks(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// no hooks
+	hooks, err := T.LocalRepo.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 0)
+
+	// hooks
+	hooksPath := path.Join(T.LocalRepoPath, git.GitDirName, vcs.GitHooksDirName)
+	err = os.MkdirAll(hooksPath, os.FileMode(0755))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(hooksPath, "pre-commit"), []byte("#!/bin/sh\nexit 0\n"), os.FileMode(0755))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(hooksPath, "post-merge.sample"), []byte("#!/bin/sh\nexit 0\n"), os.FileMode(0755))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(hooksPath, "README"), []byte("not executable"), os.FileMode(0644))
+	require.Nil(t, err)
+
+	// validate
+	hooks, err = T.LocalRepo.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 2)
+	require.Equal(t, "post-merge.sample", hooks[0].Name)
+	require.True(t, hooks[0].IsSample)
+	require.Equal(t, "pre-commit", hooks[1].Name)
+	require.False(t, hooks[1].IsSample)
+	_, err = os.Stat(hooks[1].Path)
+	require.Nil(t, err)
+
+	// mem repo
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	hooks, err = c.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 0)
+}
+
+func TestGitClient_RemoveHooks(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// hooks and hooks path
+	hooksPath := path.Join(T.LocalRepoPath, git.GitDirName, vcs.GitHooksDirName)
+	err = os.MkdirAll(hooksPath, os.FileMode(0755))
+	require.Nil(t, err)
+	for _, name := range []string{"pre-commit", "post-checkout", "post-merge.sample"} {
+		err = ioutil.WriteFile(path.Join(hooksPath, name), []byte("#!/bin/sh\nexit 1\n"), os.FileMode(0755))
+		require.Nil(t, err)
+	}
+	out, err := exec.Command("git", "-C", T.LocalRepoPath, "config", "core.hooksPath", ".githooks").CombinedOutput()
+	require.Nil(t, err, string(out))
+
+	// remove
+	err = T.LocalRepo.RemoveHooks()
+	require.Nil(t, err)
+
+	// validate
+	hooks, err := T.LocalRepo.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 0)
+	files, err := ioutil.ReadDir(hooksPath)
+	require.Nil(t, err)
+	require.Len(t, files, 3)
+	for _, f := range files {
+		require.True(t, strings.HasSuffix(f.Name(), vcs.GitHookSampleSuffix))
+		require.Zero(t, f.Mode()&0111)
+	}
+	_, err = T.LocalRepo.GetConfig("core", "hooksPath")
+	require.ErrorIs(t, err, vcs.ErrConfigNotFound)
+
+	// disabled on init
+	err = ioutil.WriteFile(path.Join(hooksPath, "pre-commit"), []byte("#!/bin/sh\nexit 1\n"), os.FileMode(0755))
+	require.Nil(t, err)
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithDisableHooks(true),
+	)
+	require.Nil(t, err)
+	hooks, err = c.ListHooks()
+	require.Nil(t, err)
+	require.Len(t, hooks, 0)
+
+	// mem repo
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+		vcs.WithDisableHooks(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.RemoveHooks()
+	require.Nil(t, err)
+}
+
+func TestGitClient_CommitAllWithHash(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	hash, err := T.LocalRepo.CommitAllWithHash(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// validate
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, hash)
+	l, err := T.LocalRepo.GetCommit(hash)
+	require.Nil(t, err)
+	require.Equal(t, T.TestCommitMessage, l.Msg)
+
+	// failed commit returns no hash
+	hash, err = T.LocalRepo.CommitAllWithHash("")
+	require.ErrorIs(t, err, vcs.ErrEmptyCommitMessage)
+	require.Empty(t, hash)
+}
+
+func TestGitClient_LongPath(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// deep path within the os limits
+	deepPath := T.FsRepoPath
+	for i := 0; i < 10; i++ {
+		deepPath = path.Join(deepPath, strings.Repeat("d", 30))
+	}
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(deepPath),
+	)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(deepPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = c.Dispose()
+	require.Nil(t, err)
+	_, err = os.Stat(deepPath)
+	require.True(t, os.IsNotExist(err))
+	err = os.RemoveAll(T.FsRepoPath)
+	require.Nil(t, err)
+
+	// path exceeding the os limits fails with a clear error
+	if runtime.GOOS == "windows" {
+		t.Skip("long paths are prefixed on windows")
+	}
+	defer os.RemoveAll(T.FsRepoPath)
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(path.Join(T.FsRepoPath, strings.Repeat("d", 300))),
+	)
+	require.ErrorIs(t, err, vcs.ErrPathTooLong)
+}
+
+func TestGitClient_ImportCommits(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client without commits
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// import
+	when := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	author := object.Signature{Name: "alice", Email: "alice@crawlab.cn", When: when}
+	committer := object.Signature{Name: "bob", Email: "bob@crawlab.cn", When: when.Add(time.Hour)}
+	err = c.ImportCommits([]vcs.GitImportCommit{
+		{
+			Files:   map[string][]byte{"main.py": []byte("v1"), "spiders/a.py": []byte("a")},
+			Author:  author,
+			Message: "import 1",
+		},
+		{
+			Files:     map[string][]byte{"main.py": []byte("v2")},
+			Author:    author,
+			Committer: committer,
+			Message:   "import 2",
+		},
+		{
+			Files:   map[string][]byte{"spiders/a.py": nil, "spiders/b.py": []byte("b")},
+			Author:  author,
+			Message: "import 3",
+		},
+	})
+	require.Nil(t, err)
+
+	// logs
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 3)
+	for i, l := range logs {
+		require.Equal(t, fmt.Sprintf("import %d", 3-i), l.Msg)
+		require.Equal(t, author.Name, l.AuthorName)
+		require.Equal(t, author.Email, l.AuthorEmail)
+		require.True(t, when.Equal(l.Timestamp))
+	}
+	require.Equal(t, []string{logs[1].Hash}, logs[0].ParentHashes)
+	require.Equal(t, []string{logs[2].Hash}, logs[1].ParentHashes)
+	require.Len(t, logs[2].ParentHashes, 0)
+	commit, err := c.GetRepository().CommitObject(plumbing.NewHash(logs[1].Hash))
+	require.Nil(t, err)
+	require.Equal(t, committer.Name, commit.Committer.Name)
+
+	// branch and worktree
+	branch, err := c.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, "main.py"))
+	require.Nil(t, err)
+	require.Equal(t, "v2", string(data))
+	data, err = ioutil.ReadFile(path.Join(T.FsRepoPath, "spiders", "b.py"))
+	require.Nil(t, err)
+	require.Equal(t, "b", string(data))
+	_, err = os.Stat(path.Join(T.FsRepoPath, "spiders", "a.py"))
+	require.True(t, os.IsNotExist(err))
+	status, err := c.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 0)
+	out, err := exec.Command("git", "-C", T.FsRepoPath, "fsck", "--strict").CombinedOutput()
+	require.Nil(t, err, string(out))
+}
+
+func TestGitClient_HashFile(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit
+	filePath := path.Join("spiders", T.TestFileName)
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "spiders"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, filePath), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// matches the committed blob
+	hash, err := T.LocalRepo.HashFile(filePath)
+	require.Nil(t, err)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	commit, err := T.LocalRepo.GetRepository().CommitObject(plumbing.NewHash(headHash))
+	require.Nil(t, err)
+	f, err := commit.File(filePath)
+	require.Nil(t, err)
+	require.Equal(t, f.Hash.String(), hash)
+	require.Equal(t, hash, T.LocalRepo.HashBytes([]byte(T.TestFileContent)))
+
+	// matches git hash-object
+	out, err := exec.Command("git", "-C", T.LocalRepoPath, "hash-object", filePath).Output()
+	require.Nil(t, err)
+	require.Equal(t, strings.TrimSpace(string(out)), hash)
+
+	// changed locally
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, filePath), []byte("changed"), os.FileMode(0766))
+	require.Nil(t, err)
+	hash, err = T.LocalRepo.HashFile(filePath)
+	require.Nil(t, err)
+	require.NotEqual(t, f.Hash.String(), hash)
+
+	// empty blob
+	require.Equal(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", T.LocalRepo.HashBytes(nil))
+}
+
+func TestGitClient_WithDisposeRetry(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// packed remote history
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// clone and read from packfiles
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithDisposeRetry(3, 10*time.Millisecond),
+	)
+	require.Nil(t, err)
+	packs, err := filepath.Glob(path.Join(T.FsRepoPath, git.GitDirName, "objects", "pack", "*.pack"))
+	require.Nil(t, err)
+	require.NotEmpty(t, packs)
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	_, err = c.GetFileContentAtRef(T.TestFileName, "HEAD")
+	require.Nil(t, err)
+
+	// dispose
+	err = c.Dispose()
+	require.Nil(t, err)
+	_, err = os.Stat(T.FsRepoPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGitClient_GetMergedBranches(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// merged branch (fast-forwarded into master)
+	r := T.LocalRepo.GetRepository()
+	err = T.LocalRepo.CheckoutBranch("feature-merged")
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	mergedHash, err := T.LocalRepo.CommitAllWithHash("merged change")
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutBranch(vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(vcs.GitBranchNameMaster), plumbing.NewHash(mergedHash)))
+	require.Nil(t, err)
+	err = T.LocalRepo.Reset(vcs.WithMode(git.HardReset))
+	require.Nil(t, err)
+
+	// unmerged branch
+	err = T.LocalRepo.CheckoutBranch("feature-unmerged")
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte("unmerged"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("unmerged change")
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutBranch(vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+
+	// validate
+	merged, unmerged, err := T.LocalRepo.GetMergedBranches("")
+	require.Nil(t, err)
+	require.Equal(t, []string{"feature-merged"}, merged)
+	require.Equal(t, []string{"feature-unmerged"}, unmerged)
+	ok, err := T.LocalRepo.IsAncestor("feature-merged", vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = T.LocalRepo.IsAncestor("feature-unmerged", vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// into another branch
+	merged, unmerged, err = T.LocalRepo.GetMergedBranches("feature-unmerged")
+	require.Nil(t, err)
+	require.Equal(t, []string{"feature-merged", vcs.GitBranchNameMaster}, merged)
+	require.Len(t, unmerged, 0)
+}
+
+func TestGitClient_WithHTTPHeaders(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// git http server recording the header
+	gitBin, err := exec.LookPath("git")
+	require.Nil(t, err)
+	remoteRoot, err := filepath.Abs(path.Dir(T.RemoteRepoPath))
+	require.Nil(t, err)
+	backend := &cgi.Handler{
+		Path: gitBin,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + remoteRoot,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+	var mu sync.Mutex
+	var values []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		values = append(values, r.Header.Get("X-Api-Key"))
+		mu.Unlock()
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	serverRepoUrl := server.URL + "/" + path.Base(T.RemoteRepoPath)
+
+	// origin
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(serverRepoUrl),
+		vcs.WithHTTPHeaders(map[string]string{"X-Api-Key": "secret"}),
+	)
+	require.Nil(t, err)
+	err = c.Fetch()
+	require.Nil(t, err)
+	require.Nil(t, c.Dispose())
+	mu.Lock()
+	require.NotEmpty(t, values)
+	for _, v := range values {
+		require.Equal(t, "secret", v)
+	}
+	values = nil
+	mu.Unlock()
+
+	// named non-origin remote of a client with a local origin
+	c, err = vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithHTTPHeaders(map[string]string{"X-Api-Key": "secret"}),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	_, err = c.GetRepository().CreateRemote(&config.RemoteConfig{
+		Name: "upstream",
+		URLs: []string{serverRepoUrl},
+	})
+	require.Nil(t, err)
+	err = c.Fetch(vcs.WithRemoteNameFetch("upstream"))
+	require.Nil(t, err)
+	refs, err := c.GetRemoteRefs("upstream")
+	require.Nil(t, err)
+	require.NotEmpty(t, refs)
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, values)
+	for _, v := range values {
+		require.Equal(t, "secret", v)
+	}
+}
+
+func TestGitClient_ResolveTagCommit(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// tags
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	tagger := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()}
+	_, err = r.CreateTag("lightweight", headRef.Hash(), nil)
+	require.Nil(t, err)
+	annotated, err := r.CreateTag("v1.0.0", headRef.Hash(), &git.CreateTagOptions{
+		Tagger:  tagger,
+		Message: "release",
+	})
+	require.Nil(t, err)
+	_, err = r.CreateTag("v1.0.0-final", annotated.Hash(), &git.CreateTagOptions{
+		Tagger:  tagger,
+		Message: "tag of a tag",
+	})
+	require.Nil(t, err)
+
+	// resolve
+	for _, name := range []string{"lightweight", "v1.0.0", "v1.0.0-final"} {
+		l, err := T.LocalRepo.ResolveTagCommit(name)
+		require.Nil(t, err)
+		require.Equal(t, headRef.Hash().String(), l.Hash)
+		require.Equal(t, T.InitialCommitMessage, l.Msg)
+	}
+}
+
+func TestGitClient_Cancel(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// server hanging until the request is aborted
+	var hang int32
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&hang) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(server.URL+"/repo.git"),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+
+	// pull in background
+	atomic.StoreInt32(&hang, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Pull()
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pull did not reach the server")
+	}
+
+	// cancel
+	c.Cancel()
+	select {
+	case err = <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pull did not return after cancel")
+	}
+
+	// later operations are not affected
+	atomic.StoreInt32(&hang, 0)
+	_, err = c.GetRemoteRefs(vcs.GitRemoteNameOrigin)
+	require.NotErrorIs(t, err, context.Canceled)
+}
+
+func TestGitClient_CatObject(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit with a nested file
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "dir"), os.ModePerm)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "dir", T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// objects
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	commit, err := T.LocalRepo.GetRepository().CommitObject(plumbing.NewHash(headHash))
+	require.Nil(t, err)
+	file, err := commit.File("dir/" + T.TestFileName)
+	require.Nil(t, err)
+
+	// compare against git cat-file
+	for _, item := range []struct {
+		hash    string
+		objType string
+	}{
+		{file.Hash.String(), "blob"},
+		{commit.TreeHash.String(), "tree"},
+		{headHash, "commit"},
+	} {
+		objType, content, err := T.LocalRepo.CatObject(item.hash)
+		require.Nil(t, err)
+		require.Equal(t, item.objType, objType)
+		out, err := exec.Command("git", "-C", T.LocalRepoPath, "cat-file", "-p", item.hash).CombinedOutput()
+		require.Nil(t, err, string(out))
+		require.Equal(t, string(out), string(content))
+	}
+	_, content, err := T.LocalRepo.CatObject(file.Hash.String())
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(content))
+
+	// unknown object
+	_, _, err = T.LocalRepo.CatObject(plumbing.ZeroHash.String())
+	require.ErrorIs(t, err, vcs.ErrObjectNotFound)
+}
+
+func TestGitClient_WithRemoteFetchRefSpecs(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// pull request ref on the remote
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("proposed change")
+	require.Nil(t, err)
+	prHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = T.LocalRepo.Push(vcs.WithRefSpecs([]config.RefSpec{"refs/heads/master:refs/pull/1/head"}))
+	require.Nil(t, err)
+
+	// worker with pull request refs configured on origin
+	specs := []config.RefSpec{
+		"+refs/heads/*:refs/remotes/origin/*",
+		"+refs/pull/*/head:refs/remotes/origin/pr/*",
+	}
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithRemoteFetchRefSpecs(specs),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	remote, err := c.GetRemote(vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	require.Equal(t, specs, remote.Config().Fetch)
+
+	// bare fetch grabs the extra refs
+	err = c.Fetch()
+	require.Nil(t, err)
+	ref, err := c.GetRepository().Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, "pr/1"), false)
+	require.Nil(t, err)
+	require.Equal(t, prHash, ref.Hash().String())
+	_, err = c.GetRepository().Reference(plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster), false)
+	require.Nil(t, err)
+
+	// persisted in the repo config
+	r, err := git.PlainOpen(T.FsRepoPath)
+	require.Nil(t, err)
+	cfg, err := r.Config()
+	require.Nil(t, err)
+	require.Equal(t, specs, cfg.Remotes[vcs.GitRemoteNameOrigin].Fetch)
+}
+
+func TestFindRepoRoot(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// nested path inside a repo
+	nestedPath := path.Join(T.LocalRepoPath, "a", "b")
+	err = os.MkdirAll(nestedPath, os.ModePerm)
+	require.Nil(t, err)
+	root, ok, err := vcs.FindRepoRoot(nestedPath)
+	require.Nil(t, err)
+	require.True(t, ok)
+	expected, err := filepath.Abs(T.LocalRepoPath)
+	require.Nil(t, err)
+	require.Equal(t, expected, root)
+
+	// init inside the repo is refused on demand
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(nestedPath),
+		vcs.WithNoNestedRepo(true),
+	)
+	require.ErrorIs(t, err, vcs.ErrNestedRepo)
+	require.False(t, vcs.IsGitRepoExists(nestedPath))
+
+	// standalone directory
+	standalonePath, err := ioutil.TempDir("", "crawlab-vcs-")
+	require.Nil(t, err)
+	defer os.RemoveAll(standalonePath)
+	_, ok, err = vcs.FindRepoRoot(standalonePath)
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestGitClient_RewordCommit(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits on top of the initial commit
+	var hashes []string
+	for i := 1; i <= 3; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fmt.Sprintf("file_%d.txt", i)), []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("commit %d", i))
+		require.Nil(t, err)
+		hash, err := T.LocalRepo.GetHeadHash()
+		require.Nil(t, err)
+		hashes = append(hashes, hash)
+	}
+	r := T.LocalRepo.GetRepository()
+	oldHead, err := r.CommitObject(plumbing.NewHash(hashes[2]))
+	require.Nil(t, err)
+
+	// reword the commit two steps back
+	err = T.LocalRepo.RewordCommit(hashes[0], "commit 1 (reworded)")
+	require.Nil(t, err)
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 4)
+	require.Equal(t, "commit 3", logs[0].Msg)
+	require.Equal(t, "commit 2", logs[1].Msg)
+	require.Equal(t, "commit 1 (reworded)", logs[2].Msg)
+	require.Equal(t, T.InitialCommitMessage, logs[3].Msg)
+	for i := 0; i < 3; i++ {
+		require.NotContains(t, hashes, logs[i].Hash)
+	}
+
+	// tree content unchanged
+	newHead, err := r.CommitObject(plumbing.NewHash(logs[0].Hash))
+	require.Nil(t, err)
+	require.Equal(t, oldHead.TreeHash, newHead.TreeHash)
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Empty(t, status)
+
+	// pushed commits are refused unless forced
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	err = T.LocalRepo.RewordCommit(logs[1].Hash, "commit 2 (reworded)")
+	require.ErrorIs(t, err, vcs.ErrCommitPushed)
+	err = T.LocalRepo.RewordCommit(logs[1].Hash, "commit 2 (reworded)", vcs.WithForceReword(true))
+	require.Nil(t, err)
+	logs, err = T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Equal(t, "commit 2 (reworded)", logs[1].Msg)
+}
+
+func TestGitClient_GetTagsDetailed(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// tags (lightweight tags take the commit time)
+	r := T.LocalRepo.GetRepository()
+	headRef, err := r.Head()
+	require.Nil(t, err)
+	headCommit, err := r.CommitObject(headRef.Hash())
+	require.Nil(t, err)
+	base := headCommit.Committer.When
+	_, err = r.CreateTag("lightweight", headRef.Hash(), nil)
+	require.Nil(t, err)
+	for i, name := range []string{"v1.0.0", "v1.1.0", "v2.0.0"} {
+		_, err = r.CreateTag(name, headRef.Hash(), &git.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: base.Add(time.Duration(i+1) * time.Hour)},
+			Message: "release " + name,
+		})
+		require.Nil(t, err)
+	}
+
+	// all
+	details, err := T.LocalRepo.GetTagsDetailed()
+	require.Nil(t, err)
+	require.Len(t, details, 4)
+	var names []string
+	for _, d := range details {
+		names = append(names, d.Name)
+		require.Equal(t, headRef.Hash().String(), d.TargetCommitHash)
+	}
+	require.Equal(t, []string{"v2.0.0", "v1.1.0", "v1.0.0", "lightweight"}, names)
+	require.True(t, details[0].IsAnnotated)
+	require.Equal(t, "crawlab", details[0].TaggerName)
+	require.Equal(t, "crawlab@example.com", details[0].TaggerEmail)
+	require.Equal(t, "release v2.0.0\n", details[0].Message)
+	require.Equal(t, base.Add(3*time.Hour).Unix(), details[0].TaggedAt.Unix())
+	require.False(t, details[3].IsAnnotated)
+	require.Empty(t, details[3].TaggerName)
+	require.Equal(t, base.Unix(), details[3].TaggedAt.Unix())
+
+	// paginated
+	details, err = T.LocalRepo.GetTagsDetailed(vcs.WithSkipTagList(1), vcs.WithLimitTagList(2))
+	require.Nil(t, err)
+	require.Len(t, details, 2)
+	require.Equal(t, "v1.1.0", details[0].Name)
+	require.Equal(t, "v1.0.0", details[1].Name)
+	details, err = T.LocalRepo.GetTagsDetailed(vcs.WithSkipTagList(4))
+	require.Nil(t, err)
+	require.Empty(t, details)
+}
+
+func TestGitClient_CommitAll_WithAtomic(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// staged and unstaged changes
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "staged.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.Add("staged.txt")
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	statusBefore, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	headBefore, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// sign key that cannot sign (encrypted private key), so the commit is rejected
+	entity, err := openpgp.NewEntity("test", "", "test@crawlab.cn", nil)
+	require.Nil(t, err)
+	err = entity.PrivateKey.Encrypt([]byte("passphrase"))
+	require.Nil(t, err)
+
+	// atomic commit restores the index
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage, vcs.WithSignKey(entity), vcs.WithAtomic(true))
+	require.NotNil(t, err)
+	statusAfter, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Equal(t, statusBefore, statusAfter)
+	headAfter, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headBefore, headAfter)
+
+	// without atomic the index is left staged
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage, vcs.WithSignKey(entity))
+	require.NotNil(t, err)
+	statusAfter, err = T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.NotEqual(t, statusBefore, statusAfter)
+}
+
+func TestGitClient_SetDescription(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// bare repo
+	err = vcs.CreateBareGitRepo(T.FsRepoPath)
+	require.Nil(t, err)
+	c, err := vcs.NewGitClient(vcs.WithPath(T.FsRepoPath))
+	require.Nil(t, err)
+	defer c.Dispose()
+	desc, err := c.GetDescription()
+	require.Nil(t, err)
+	require.Empty(t, desc)
+
+	// set and get
+	err = c.SetDescription("crawlab spider repo")
+	require.Nil(t, err)
+	desc, err = c.GetDescription()
+	require.Nil(t, err)
+	require.Equal(t, "crawlab spider repo", desc)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, vcs.GitDescriptionFileName))
+	require.Nil(t, err)
+	require.Equal(t, "crawlab spider repo\n", string(data))
+
+	// mem repo
+	memRepo, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+	defer memRepo.Dispose()
+	err = memRepo.SetDescription("crawlab spider repo")
+	require.ErrorIs(t, err, vcs.ErrNotFsRepo)
+	_, err = memRepo.GetDescription()
+	require.ErrorIs(t, err, vcs.ErrNotFsRepo)
+}
+
+func TestGitClient_FindLargeObjects(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// large and small files
+	largeData := bytes.Repeat([]byte("crawlab"), 1<<16)
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "data"), os.ModePerm)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "data", "large.csv"), largeData, os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "small.txt"), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	firstHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// same blob under another path in a later commit
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "large_copy.csv"), largeData, os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("copy large file")
+	require.Nil(t, err)
+	secondHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// find
+	objects, err := T.LocalRepo.FindLargeObjects(1 << 10)
+	require.Nil(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, T.LocalRepo.HashBytes(largeData), objects[0].Hash)
+	require.Equal(t, int64(len(largeData)), objects[0].Size)
+	require.Equal(t, []string{"data/large.csv", "large_copy.csv"}, objects[0].Paths)
+	require.Equal(t, []string{secondHash, firstHash}, objects[0].Commits)
+
+	// threshold above every object
+	objects, err = T.LocalRepo.FindLargeObjects(int64(len(largeData)))
+	require.Nil(t, err)
+	require.Empty(t, objects)
+}
+
+func TestGitClient_Reinit(t *testing.T) {
+	var err error
+	T.Setup(t)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// constructed while the remote is unreachable
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl("http://127.0.0.1:1/repo.git"),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	_, err = c.GetHeadHash()
+	require.NotNil(t, err)
+
+	// reinit once the remote is reachable
+	c.SetRemoteUrl(T.RemoteRepoPath)
+	err = c.Reinit()
+	require.Nil(t, err)
+	data, err := ioutil.ReadFile(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// idempotent, with a single remote
+	err = c.Reinit()
+	require.Nil(t, err)
+	remotes, err := c.GetRepository().Remotes()
+	require.Nil(t, err)
+	require.Len(t, remotes, 1)
+	require.Equal(t, []string{T.RemoteRepoPath}, remotes[0].Config().URLs)
+}
+
+func TestGitClient_BranchExists(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// refs
+	err = T.LocalRepo.CreateBranch(T.TestBranchName, "", nil)
+	require.Nil(t, err)
+	headRef, err := T.LocalRepo.GetRepository().Head()
+	require.Nil(t, err)
+	_, err = T.LocalRepo.GetRepository().CreateTag("v1.0.0", headRef.Hash(), nil)
+	require.Nil(t, err)
+
+	// branches
+	ok, err := T.LocalRepo.BranchExists(T.TestBranchName)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = T.LocalRepo.BranchExists("missing")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// tags
+	ok, err = T.LocalRepo.TagExists("v1.0.0")
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = T.LocalRepo.TagExists("v2.0.0")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// remotes
+	ok, err = T.LocalRepo.RemoteExists(vcs.GitRemoteNameOrigin)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = T.LocalRepo.RemoteExists("upstream")
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestGitClient_GetThreeWayContent(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// base
+	filePath := path.Join(T.LocalRepoPath, T.ConflictFileName)
+	err = ioutil.WriteFile(filePath, []byte("base\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("base")
+	require.Nil(t, err)
+
+	// theirs
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(filePath, []byte("theirs\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("theirs")
+	require.Nil(t, err)
+
+	// ours
+	err = T.LocalRepo.Checkout(vcs.WithBranch(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(filePath, []byte("ours\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll("ours")
+	require.Nil(t, err)
+
+	// versions
+	base, ours, theirs, err := T.LocalRepo.GetThreeWayContent(T.ConflictFileName, vcs.GitBranchNameMaster, T.TestBranchName)
+	require.Nil(t, err)
+	require.Equal(t, "base\n", string(base))
+	require.Equal(t, "ours\n", string(ours))
+	require.Equal(t, "theirs\n", string(theirs))
+
+	// missing file
+	_, _, _, err = T.LocalRepo.GetThreeWayContent("missing.txt", vcs.GitBranchNameMaster, T.TestBranchName)
+	require.ErrorIs(t, err, vcs.ErrFileNotFoundInTree)
+}
+
+func TestGitClient_Fetch_WithFetchCommit(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// two commits on the remote, fetch the older one
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+	commitHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// empty repo
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithNoAutoRemote(true),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = c.AddRemote(vcs.GitRemoteNameOrigin, T.RemoteRepoPath)
+	require.Nil(t, err)
+
+	// server disallowing sha1 wants
+	err = c.Fetch(vcs.WithFetchCommit(commitHash))
+	require.ErrorIs(t, err, vcs.ErrFetchCommitNotSupported)
+
+	// server allowing sha1 wants
+	out, err := exec.Command("git", "-C", T.RemoteRepoPath, "config", "uploadpack.allowAnySHA1InWant", "true").CombinedOutput()
+	require.Nil(t, err, string(out))
+	err = c.Fetch(vcs.WithFetchCommit(commitHash))
+	require.Nil(t, err)
+	ref, err := c.GetRepository().Reference(vcs.GitFetchHead, false)
+	require.Nil(t, err)
+	require.Equal(t, commitHash, ref.Hash().String())
+	refs, err := c.GetAllRefs()
+	require.Nil(t, err)
+	for _, r := range refs {
+		require.NotEqual(t, plumbing.NewRemoteReferenceName(vcs.GitRemoteNameOrigin, vcs.GitBranchNameMaster).String(), r.FullName)
+	}
+
+	// check out detached
+	err = c.CheckoutHash(commitHash)
+	require.Nil(t, err)
+	headHash, err := c.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, commitHash, headHash)
+	_, err = os.Stat(path.Join(T.FsRepoPath, T.TestFileName))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGitClient_GetConflictCount(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// clean
+	count, err := T.LocalRepo.GetConflictCount()
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	// conflicting merge
+	T.CreateConflict(t)
+	count, err = T.LocalRepo.GetConflictCount()
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestGitClient_MaterializeRef(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// old and current versions
+	oldHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// materialize into another directory
+	destDir := path.Join(path.Dir(T.FsRepoPath), "materialized")
+	defer os.RemoveAll(destDir)
+	err = T.LocalRepo.MaterializeRef(headHash, destDir)
+	require.Nil(t, err)
+	data, err := ioutil.ReadFile(path.Join(destDir, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// materialize the old version into the worktree
+	err = T.LocalRepo.MaterializeRef(oldHash, "")
+	require.Nil(t, err)
+	_, err = os.Stat(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.True(t, os.IsNotExist(err))
+	currentHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	require.Equal(t, headHash, currentHash)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, status, 1)
+	require.Equal(t, T.TestFileName, status[0].Path)
+
+	// discard
+	err = T.LocalRepo.Reset()
+	require.Nil(t, err)
+	data, err = ioutil.ReadFile(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// symlinked and absolute paths to the worktree are the worktree
+	absPath, err := filepath.Abs(T.LocalRepoPath)
+	require.Nil(t, err)
+	linkPath := path.Join(path.Dir(T.FsRepoPath), "worktree-link")
+	err = os.Symlink(absPath, linkPath)
+	require.Nil(t, err)
+	defer os.Remove(linkPath)
+	for _, dir := range []string{linkPath, absPath} {
+		err = T.LocalRepo.MaterializeRef(oldHash, dir)
+		require.Nil(t, err)
+		_, err = os.Stat(path.Join(T.LocalRepoPath, T.TestFileName))
+		require.True(t, os.IsNotExist(err))
+		status, err = T.LocalRepo.GetStatus()
+		require.Nil(t, err)
+		require.Len(t, status, 1)
+		err = T.LocalRepo.Reset()
+		require.Nil(t, err)
+	}
+}
+
+type testMetricsRecorder struct {
+	mu        sync.Mutex
+	ops       map[string]int
+	errors    map[string]int
+	durations map[string][]time.Duration
+}
+
+func (r *testMetricsRecorder) IncOp(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops[name]++
+}
+
+func (r *testMetricsRecorder) ObserveDuration(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.durations[name] = append(r.durations[name], d)
+}
+
+func (r *testMetricsRecorder) IncError(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors[name]++
+}
+
+func TestGitClient_WithMetrics(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// git client with recorder
+	recorder := &testMetricsRecorder{
+		ops:       map[string]int{},
+		errors:    map[string]int{},
+		durations: map[string][]time.Duration{},
+	}
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithMetrics(recorder),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	require.Equal(t, 1, recorder.ops["init"])
+
+	// commit
+	err = ioutil.WriteFile(path.Join(T.FsRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = c.Add(T.TestFileName)
+	require.Nil(t, err)
+	err = c.Commit(T.TestCommitMessage)
+	require.Nil(t, err)
+	require.Equal(t, 1, recorder.ops["commit"])
+	require.Len(t, recorder.durations["commit"], 1)
+	require.Greater(t, recorder.durations["commit"][0], time.Duration(0))
+	require.Zero(t, recorder.errors["commit"])
+
+	// failed commit (sign key that cannot sign)
+	entity, err := openpgp.NewEntity("test", "", "test@crawlab.cn", nil)
+	require.Nil(t, err)
+	err = entity.PrivateKey.Encrypt([]byte("passphrase"))
+	require.Nil(t, err)
+	err = c.Commit(T.TestCommitMessage, vcs.WithSignKey(entity))
+	require.NotNil(t, err)
+	require.Equal(t, 2, recorder.ops["commit"])
+	require.Len(t, recorder.durations["commit"], 2)
+	require.Equal(t, 1, recorder.errors["commit"])
+}
+
+func TestGitClient_WithDefaultFileMode(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// file at ref
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.Push()
+	require.Nil(t, err)
+
+	// default mode
+	err = os.Remove(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	err = T.LocalRepo.RestoreFile(T.TestFileName, "HEAD")
+	require.Nil(t, err)
+	info, err := os.Stat(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitDefaultFileMode, info.Mode().Perm())
+
+	// configured mode
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithRemoteUrl(T.RemoteRepoPath),
+		vcs.WithDefaultFileMode(0600),
+	)
+	require.Nil(t, err)
+	defer c.Dispose()
+	err = os.Remove(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	err = c.RestoreFile(T.TestFileName, "HEAD")
+	require.Nil(t, err)
+	info, err = os.Stat(path.Join(T.FsRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestGitClient_Squash(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// three linear commits
+	baseHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fmt.Sprintf("file_%d.txt", i)), []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+		author := &object.Signature{Name: fmt.Sprintf("author %d", i), Email: "crawlab@example.com", When: time.Now()}
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("commit %d", i), vcs.WithAuthor(author))
+		require.Nil(t, err)
+	}
+	r := T.LocalRepo.GetRepository()
+	headHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	oldHead, err := r.CommitObject(plumbing.NewHash(headHash))
+	require.Nil(t, err)
+
+	// squash
+	err = T.LocalRepo.Squash(baseHash, "squashed")
+	require.Nil(t, err)
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, "squashed", logs[0].Msg)
+	require.Equal(t, "author 1", logs[0].AuthorName)
+	require.Equal(t, []string{baseHash}, logs[0].ParentHashes)
+	require.Equal(t, baseHash, logs[1].Hash)
+
+	// final tree intact
+	newHead, err := r.CommitObject(plumbing.NewHash(logs[0].Hash))
+	require.Nil(t, err)
+	require.Equal(t, oldHead.TreeHash, newHead.TreeHash)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	status, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Empty(t, status)
+
+	// merge commits are refused
+	author := &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()}
+	mergeHash, err := T.LocalRepo.CommitTree(newHead.TreeHash.String(), []string{newHead.Hash.String(), baseHash}, "merge", author)
+	require.Nil(t, err)
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(vcs.GitBranchNameMaster), plumbing.NewHash(mergeHash)))
+	require.Nil(t, err)
+	err = T.LocalRepo.Squash(baseHash, "squashed")
+	require.ErrorIs(t, err, vcs.ErrSquashMergeCommit)
+}
+
+func TestGitClient_GetMaintenanceInfo(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits
+	for i := 1; i <= 5; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fmt.Sprintf("file_%d.txt", i)), []byte(fmt.Sprintf("content %d", i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("commit %d", i))
+		require.Nil(t, err)
+	}
+
+	// loose objects
+	info, err := T.LocalRepo.GetMaintenanceInfo()
+	require.Nil(t, err)
+	require.Greater(t, info.LooseObjects, 0)
+	require.Equal(t, 0, info.PackFiles)
+	require.Greater(t, info.Size, int64(0))
+	out, err := exec.Command("git", "-C", T.LocalRepoPath, "count-objects", "-v").CombinedOutput()
+	require.Nil(t, err, string(out))
+	require.Contains(t, string(out), fmt.Sprintf("count: %d\n", info.LooseObjects))
+
+	// packed
+	out, err = exec.Command("git", "-C", T.LocalRepoPath, "gc", "--quiet").CombinedOutput()
+	require.Nil(t, err, string(out))
+	info, err = T.LocalRepo.GetMaintenanceInfo()
+	require.Nil(t, err)
+	require.Equal(t, 0, info.LooseObjects)
+	require.Equal(t, 1, info.PackFiles)
+
+	// mem repo
+	memRepo, err := vcs.NewGitClient(
+		vcs.WithPath(T.MemRepoPath),
+		vcs.WithIsMem(),
+	)
+	require.Nil(t, err)
+	defer memRepo.Dispose()
+	_, err = memRepo.GetMaintenanceInfo()
+	require.ErrorIs(t, err, vcs.ErrNotFsRepo)
+}
+
+func TestGitClient_Checkout_WithForceCheckout(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// branch with the file
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = T.LocalRepo.CreateBranch(T.TestBranchName, "", nil)
+	require.Nil(t, err)
+
+	// local edit blocks the checkout
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte("local edit"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName)
+	require.NotNil(t, err)
+
+	// forced checkout discards it
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName, vcs.WithForceCheckout(true))
+	require.Nil(t, err)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, T.TestBranchName, branch)
+	data, err := ioutil.ReadFile(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+
+	// option setting git.CheckoutOptions directly
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte("local edit"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.Checkout(
+		vcs.WithBranch(vcs.GitBranchNameMaster),
+		vcs.WithCheckoutOptions(func(o *git.CheckoutOptions) {
+			o.Force = true
+		}),
+	)
+	require.Nil(t, err)
+	branch, err = T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitBranchNameMaster, branch)
+	data, err = ioutil.ReadFile(path.Join(T.LocalRepoPath, T.TestFileName))
+	require.Nil(t, err)
+	require.Equal(t, T.TestFileContent, string(data))
+}
+
+func TestGitClient_GetTagsForCommit(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// tagged commit
+	taggedHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+	r := T.LocalRepo.GetRepository()
+	_, err = r.CreateTag("v1.0.0", plumbing.NewHash(taggedHash), nil)
+	require.Nil(t, err)
+	_, err = r.CreateTag("stable", plumbing.NewHash(taggedHash), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "crawlab", Email: "crawlab@example.com", When: time.Now()},
+		Message: "stable release",
+	})
+	require.Nil(t, err)
+
+	// untagged commit
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, T.TestFileName), []byte(T.TestFileContent), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	untaggedHash, err := T.LocalRepo.GetHeadHash()
+	require.Nil(t, err)
+
+	// tags
+	tags, err := T.LocalRepo.GetTagsForCommit(taggedHash)
+	require.Nil(t, err)
+	require.Equal(t, []string{"stable", "v1.0.0"}, tags)
+	tags, err = T.LocalRepo.GetTagsForCommit(untaggedHash)
+	require.Nil(t, err)
+	require.Empty(t, tags)
+}
+
+func TestSetGitBinaryPath(t *testing.T) {
+	var err error
+	T.Setup(t)
+	defer vcs.SetGitBinaryPath("")
+
+	// commits
+	for i := 1; i <= 3; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fmt.Sprintf("file_%d.txt", i)), []byte(fmt.Sprintf("content %d", i)), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("commit %d", i))
+		require.Nil(t, err)
+	}
+
+	// invalid binary
+	vcs.SetGitBinaryPath(path.Join(T.LocalRepoPath, "missing-git"))
+	_, err = vcs.GetGitBinaryPath()
+	require.ErrorIs(t, err, vcs.ErrGitBinaryNotFound)
+	err = T.LocalRepo.GC()
+	require.ErrorIs(t, err, vcs.ErrGitBinaryNotFound)
+
+	// binary in PATH
+	vcs.SetGitBinaryPath("")
+	gitBin, err := vcs.GetGitBinaryPath()
+	require.Nil(t, err)
+	require.NotEmpty(t, gitBin)
+	err = T.LocalRepo.GC()
+	require.Nil(t, err)
+	info, err := T.LocalRepo.GetMaintenanceInfo()
+	require.Nil(t, err)
+	require.Equal(t, 0, info.LooseObjects)
+	require.Equal(t, 1, info.PackFiles)
+
+	// objects still readable after packing
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 4)
+	_, err = T.LocalRepo.GetFileContentAtRef("file_1.txt", "HEAD")
+	require.Nil(t, err)
+}
+
+func TestGitClient_GetUnstagedDiff(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit two files
+	stagedFilePath := path.Join(T.LocalRepoPath, "staged.txt")
+	unstagedFilePath := path.Join(T.LocalRepoPath, "unstaged.txt")
+	err = ioutil.WriteFile(stagedFilePath, []byte("staged\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(unstagedFilePath, []byte("unstaged\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// no changes
+	files, err := T.LocalRepo.GetUnstagedDiff("")
+	require.Nil(t, err)
+	require.Empty(t, files)
+	files, err = T.LocalRepo.GetStagedDiff("")
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	// stage one edit, leave the other unstaged
+	err = ioutil.WriteFile(stagedFilePath, []byte("staged\nedited\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.Add("staged.txt")
+	require.Nil(t, err)
+	err = ioutil.WriteFile(unstagedFilePath, []byte("unstaged\nedited\n"), os.FileMode(0766))
+	require.Nil(t, err)
+
+	// unstaged
+	files, err = T.LocalRepo.GetUnstagedDiff("")
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "unstaged.txt", files[0].Path)
+	require.Equal(t, vcs.GitDiffStatusModified, files[0].Status)
+	require.Len(t, files[0].Hunks, 1)
+	require.Contains(t, files[0].Hunks[0].Lines, vcs.GitDiffLine{Type: vcs.GitDiffLineTypeAdd, Content: "edited"})
+
+	// staged
+	files, err = T.LocalRepo.GetStagedDiff("")
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "staged.txt", files[0].Path)
+	require.Equal(t, vcs.GitDiffStatusModified, files[0].Status)
+	require.Len(t, files[0].Hunks, 1)
+	require.Contains(t, files[0].Hunks[0].Lines, vcs.GitDiffLine{Type: vcs.GitDiffLineTypeAdd, Content: "edited"})
+
+	// path filter
+	files, err = T.LocalRepo.GetUnstagedDiff("staged.txt")
+	require.Nil(t, err)
+	require.Empty(t, files)
+	files, err = T.LocalRepo.GetStagedDiff("unstaged.txt")
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	// unstaged deletion
+	err = os.Remove(unstagedFilePath)
+	require.Nil(t, err)
+	files, err = T.LocalRepo.GetUnstagedDiff("unstaged.txt")
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, vcs.GitDiffStatusDeleted, files[0].Status)
+}
+
+func TestGitClient_CheckoutPaths(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commit files in a directory and outside of it
+	dirPath := path.Join(T.LocalRepoPath, "spider")
+	err = os.MkdirAll(path.Join(dirPath, "lib"), os.FileMode(0766))
+	require.Nil(t, err)
+	fileNames := []string{"spider/main.py", "spider/items.py", "spider/lib/utils.py", "other.py"}
+	for _, fileName := range fileNames {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fileName), []byte(fileName), os.FileMode(0766))
+		require.Nil(t, err)
+	}
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+
+	// modify all files, delete one
+	for _, fileName := range fileNames {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fileName), []byte("changed"), os.FileMode(0766))
+		require.Nil(t, err)
+	}
+	err = os.Remove(path.Join(dirPath, "items.py"))
+	require.Nil(t, err)
+
+	// restore the directory with a single glob
+	err = T.LocalRepo.CheckoutPaths([]string{"spider/*"})
+	require.Nil(t, err)
+	for _, fileName := range fileNames[:3] {
+		data, err := ioutil.ReadFile(path.Join(T.LocalRepoPath, fileName))
+		require.Nil(t, err)
+		require.Equal(t, fileName, string(data))
+	}
+	data, err := ioutil.ReadFile(path.Join(T.LocalRepoPath, "other.py"))
+	require.Nil(t, err)
+	require.Equal(t, "changed", string(data))
+	statusList, err := T.LocalRepo.GetStatus()
+	require.Nil(t, err)
+	require.Len(t, statusList, 1)
+	require.Equal(t, "other.py", statusList[0].Path)
+
+	// restore from a given ref
+	err = T.LocalRepo.CheckoutPaths([]string{"*.py"}, vcs.WithBranch(vcs.GitBranchNameMaster))
+	require.Nil(t, err)
+	data, err = ioutil.ReadFile(path.Join(T.LocalRepoPath, "other.py"))
+	require.Nil(t, err)
+	require.Equal(t, "other.py", string(data))
+
+	// no match
+	err = T.LocalRepo.CheckoutPaths([]string{"missing/*"})
+	require.ErrorIs(t, err, vcs.ErrNoMatchedPaths)
+}
+
+func TestIsBinaryContent(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// heuristic
+	require.False(t, vcs.IsBinaryContent(nil))
+	require.False(t, vcs.IsBinaryContent([]byte("print('hello world')\n")))
+	require.False(t, vcs.IsBinaryContent([]byte("爬虫 ünïcödé ✓\n")))
+	require.True(t, vcs.IsBinaryContent([]byte("text\x00more")))
+	require.True(t, vcs.IsBinaryContent([]byte{0xff, 0xfe, 0xfd}))
+	require.True(t, vcs.IsBinaryContent([]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00}))
+
+	// multi-byte character cut off at the inspected size
+	data := []byte(strings.Repeat("a", vcs.GitBinaryCheckSize-1) + "中")
+	require.False(t, vcs.IsBinaryContent(data))
+
+	// diff
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "text.txt"), []byte("text\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "data.bin"), []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, '\n'}, os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	logs, err := T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	files, err := T.LocalRepo.GetDiff(logs[1].Hash, logs[0].Hash)
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+	for _, f := range files {
+		switch f.Path {
+		case "data.bin":
+			require.True(t, f.IsBinary)
+			require.Empty(t, f.Hunks)
+		case "text.txt":
+			require.False(t, f.IsBinary)
+			require.NotEmpty(t, f.Hunks)
+		default:
+			t.Fatalf("unexpected file %s", f.Path)
+		}
+	}
+
+	// content at ref
+	content, err := T.LocalRepo.GetFileContentAtRef("data.bin", "HEAD")
+	require.Nil(t, err)
+	require.True(t, vcs.IsBinaryContent(content))
+
+	// non-UTF-8 text (Latin-1) keeps its hunks
+	latin1FilePath := path.Join(T.LocalRepoPath, "latin1.py")
+	err = ioutil.WriteFile(latin1FilePath, []byte("# caf\xe9\nprint(1)\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(latin1FilePath, []byte("# caf\xe9\nprint(2)\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = T.LocalRepo.CommitAll(T.TestCommitMessage)
+	require.Nil(t, err)
+	logs, err = T.LocalRepo.GetLogs()
+	require.Nil(t, err)
+	files, err = T.LocalRepo.GetDiff(logs[1].Hash, logs[0].Hash)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Len(t, files[0].Hunks, 1)
+	require.Contains(t, files[0].Hunks[0].Lines, vcs.GitDiffLine{Type: vcs.GitDiffLineTypeAdd, Content: "print(2)"})
+	hunks, err := T.LocalRepo.GetDiffHunks(logs[1].Hash, logs[0].Hash, "latin1.py")
+	require.Nil(t, err)
+	require.Len(t, hunks, 1)
+}
+
+func TestGitClient_WithNoCreate(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// missing path is an error
+	_ = os.RemoveAll(T.FsRepoPath)
+	_, err = vcs.NewGitClient(
+		vcs.WithPath(T.FsRepoPath),
+		vcs.WithNoCreate(true),
+	)
+	require.ErrorIs(t, err, vcs.ErrRepoPathNotExists)
+	_, err = os.Stat(T.FsRepoPath)
+	require.True(t, os.IsNotExist(err))
+
+	// existing repo is opened
+	c, err := vcs.NewGitClient(
+		vcs.WithPath(T.LocalRepoPath),
+		vcs.WithNoCreate(true),
+	)
+	require.Nil(t, err)
+	logs, err := c.GetLogs()
+	require.Nil(t, err)
+	require.Len(t, logs, 1)
+}
+
+func TestGitClient_RelPath(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// inside the repo
+	absPath, err := filepath.Abs(path.Join(T.LocalRepoPath, "spider", T.TestFileName))
+	require.Nil(t, err)
+	relPath, err := T.LocalRepo.RelPath(absPath)
+	require.Nil(t, err)
+	require.Equal(t, "spider/"+T.TestFileName, relPath)
+
+	// repo root
+	relPath, err = T.LocalRepo.RelPath(T.LocalRepoPath)
+	require.Nil(t, err)
+	require.Equal(t, ".", relPath)
+
+	// outside the repo
+	_, err = T.LocalRepo.RelPath(path.Join(T.RemoteRepoPath, "HEAD"))
+	require.ErrorIs(t, err, vcs.ErrPathOutsideRepo)
+	_, err = T.LocalRepo.RelPath(T.LocalRepoPath + "_sibling")
+	require.ErrorIs(t, err, vcs.ErrPathOutsideRepo)
+}
+
+func TestGitClient_CreateTags(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// commits
+	var hashes []string
+	for i := 1; i <= 2; i++ {
+		err = ioutil.WriteFile(path.Join(T.LocalRepoPath, fmt.Sprintf("file_%d.txt", i)), []byte(T.TestFileContent), os.FileMode(0766))
+		require.Nil(t, err)
+		err = T.LocalRepo.CommitAll(fmt.Sprintf("release %d", i))
+		require.Nil(t, err)
+		hash, err := T.LocalRepo.GetHeadHash()
+		require.Nil(t, err)
+		hashes = append(hashes, hash)
+	}
+	tagger := &object.Signature{Name: "releaser", Email: "releaser@example.com", When: time.Now()}
+
+	// lightweight and annotated tags at once
+	err = T.LocalRepo.CreateTags([]vcs.GitTagSpec{
+		{Name: "v1.0.0", TargetRef: hashes[0], Message: "release 1", Tagger: tagger},
+		{Name: "v1.0.0-light", TargetRef: hashes[0]},
+		{Name: "v2.0.0", TargetRef: "HEAD", Message: "release 2", Tagger: tagger},
+	})
+	require.Nil(t, err)
+	tags, err := T.LocalRepo.GetTags()
+	require.Nil(t, err)
+	require.Len(t, tags, 3)
+	details, err := T.LocalRepo.GetTagsDetailed()
+	require.Nil(t, err)
+	annotated := map[string]string{}
+	for _, d := range details {
+		if d.IsAnnotated {
+			annotated[d.Name] = d.TaggerName
+		}
+	}
+	require.Equal(t, map[string]string{"v1.0.0": "releaser", "v2.0.0": "releaser"}, annotated)
+
+	// best effort skips failing tags
+	err = T.LocalRepo.CreateTags([]vcs.GitTagSpec{
+		{Name: "v3.0.0", TargetRef: "HEAD"},
+		{Name: "v1.0.0", TargetRef: "HEAD"},
+		{Name: "v4.0.0", TargetRef: "missing"},
+	})
+	var tagErrs vcs.GitTagErrors
+	require.ErrorAs(t, err, &tagErrs)
+	require.Len(t, tagErrs, 2)
+	require.ErrorIs(t, tagErrs["v1.0.0"], git.ErrTagExists)
+	require.NotNil(t, tagErrs["v4.0.0"])
+	ok, err := T.LocalRepo.TagExists("v3.0.0")
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// atomic creates nothing if one fails
+	err = T.LocalRepo.CreateTags([]vcs.GitTagSpec{
+		{Name: "v5.0.0", TargetRef: "HEAD"},
+		{Name: "v6.0.0", TargetRef: "missing"},
+	}, vcs.WithAtomicTagCreate(true))
+	require.ErrorAs(t, err, &tagErrs)
+	require.Contains(t, tagErrs, "v6.0.0")
+	ok, err = T.LocalRepo.TagExists("v5.0.0")
+	require.Nil(t, err)
+	require.False(t, ok)
+	tags, err = T.LocalRepo.GetTags()
+	require.Nil(t, err)
+	require.Len(t, tags, 4)
+}
+
+func TestGitClient_GetAttributes(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// attributes files
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, ".gitattributes"), []byte("*.secret export-ignore\n*.txt text eol=lf\n*.png -text\n"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = os.MkdirAll(path.Join(T.LocalRepoPath, "public"), os.FileMode(0766))
+	require.Nil(t, err)
+	err = ioutil.WriteFile(path.Join(T.LocalRepoPath, "public", ".gitattributes"), []byte("*.secret !export-ignore\n"), os.FileMode(0766))
+	require.Nil(t, err)
+
+	// export-ignore
+	attrs, err := T.LocalRepo.GetAttributes("config.secret")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{vcs.GitAttributeExportIgnore: vcs.GitAttributeValueSet}, attrs)
+	attrs, err = T.LocalRepo.GetAttributes("nested/dir/keys.secret")
+	require.Nil(t, err)
+	require.Equal(t, vcs.GitAttributeValueSet, attrs[vcs.GitAttributeExportIgnore])
+
+	// unspecified in a sub directory
+	attrs, err = T.LocalRepo.GetAttributes("public/readme.secret")
+	require.Nil(t, err)
+	require.NotContains(t, attrs, vcs.GitAttributeExportIgnore)
+
+	// values and unset
+	attrs, err = T.LocalRepo.GetAttributes("notes.txt")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"text": vcs.GitAttributeValueSet, "eol": "lf"}, attrs)
+	attrs, err = T.LocalRepo.GetAttributes("logo.png")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"text": vcs.GitAttributeValueUnset}, attrs)
+
+	// no attributes
+	attrs, err = T.LocalRepo.GetAttributes("main.py")
+	require.Nil(t, err)
+	require.Empty(t, attrs)
+}
+
+func TestGitClient_ResolveSymbolicRef(t *testing.T) {
+	var err error
+	T.Setup(t)
+
+	// HEAD to the current branch
+	refName, err := T.LocalRepo.ResolveSymbolicRef("HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "refs/heads/"+vcs.GitBranchNameMaster, refName)
+	err = T.LocalRepo.CheckoutBranch(T.TestBranchName)
+	require.Nil(t, err)
+	refName, err = T.LocalRepo.ResolveSymbolicRef("HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "refs/heads/"+T.TestBranchName, refName)
+
+	// direct ref returns itself
+	refName, err = T.LocalRepo.ResolveSymbolicRef("refs/heads/" + vcs.GitBranchNameMaster)
+	require.Nil(t, err)
+	require.Equal(t, "refs/heads/"+vcs.GitBranchNameMaster, refName)
+
+	// chained symbolic refs
+	r := T.LocalRepo.GetRepository()
+	err = r.Storer.SetReference(plumbing.NewSymbolicReference("refs/aliases/current", plumbing.HEAD))
+	require.Nil(t, err)
+	refName, err = T.LocalRepo.ResolveSymbolicRef("refs/aliases/current")
+	require.Nil(t, err)
+	require.Equal(t, "refs/heads/"+T.TestBranchName, refName)
+
+	// unborn branch
+	err = r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/unborn"))
+	require.Nil(t, err)
+	refName, err = T.LocalRepo.ResolveSymbolicRef("HEAD")
+	require.Nil(t, err)
+	require.Equal(t, "refs/heads/unborn", refName)
+	branch, err := T.LocalRepo.GetCurrentBranch()
+	require.Nil(t, err)
+	require.Equal(t, "unborn", branch)
+
+	// missing ref
+	_, err = T.LocalRepo.ResolveSymbolicRef("refs/heads/missing")
+	require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
@@ -1,10 +1,35 @@
 package vcs
 
 import (
+	"bytes"
+	"github.com/crawlab-team/go-trace"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	utildiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
 	"os/user"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
+var scpUrlRegexp, _ = regexp.Compile("^([^@/]+@)?([^:/]+):(.*)$")
+
+var mailmapIdentityRegexp, _ = regexp.Compile(`^\s*(.*?)\s*<([^>]*)>\s*$`)
+
+var progressPercentRegexp, _ = regexp.Compile(`^(.+?):\s+(\d+)% \((\d+)/(\d+)\)(, done\.)?`)
+
+var progressCountRegexp, _ = regexp.Compile(`^(.+?):\s+(\d+)(, done\.)?$`)
+
 func getDefaultPublicKeyPath() (path string) {
 	u, err := user.Current()
 	if err != nil {
@@ -13,3 +38,474 @@ func getDefaultPublicKeyPath() (path string) {
 	path = filepath.Join(u.HomeDir, ".ssh", "id_rsa")
 	return
 }
+
+func replaceUrlHost(rawUrl, oldHost, newHost string) (res string) {
+	// http(s)://host/path, ssh://user@host:port/path
+	if strings.Contains(rawUrl, "://") {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return rawUrl
+		}
+		if u.Host == oldHost {
+			u.Host = newHost
+		} else if u.Hostname() == oldHost {
+			u.Host = newHost + ":" + u.Port()
+		} else {
+			return rawUrl
+		}
+		return u.String()
+	}
+
+	// user@host:path
+	m := scpUrlRegexp.FindStringSubmatch(rawUrl)
+	if len(m) < 4 || m[2] != oldHost {
+		return rawUrl
+	}
+	return m[1] + newHost + ":" + m[3]
+}
+
+func redactUrl(rawUrl string) (res string) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.User == nil {
+		return rawUrl
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// getDiffHunks splits patch chunks into hunks of changed lines surrounded by
+// contextLines lines of context, merging hunks whose context overlaps.
+func getDiffHunks(chunks []diff.Chunk, contextLines int) (hunks []GitDiffHunk) {
+	// lines
+	var lines []GitDiffLine
+	for _, chunk := range chunks {
+		var lineType string
+		switch chunk.Type() {
+		case diff.Add:
+			lineType = GitDiffLineTypeAdd
+		case diff.Delete:
+			lineType = GitDiffLineTypeDelete
+		default:
+			lineType = GitDiffLineTypeContext
+		}
+		content := strings.TrimSuffix(chunk.Content(), "\n")
+		for _, line := range strings.Split(content, "\n") {
+			lines = append(lines, GitDiffLine{Type: lineType, Content: line})
+		}
+	}
+
+	// hunks
+	oldLineNo, newLineNo := 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].Type == GitDiffLineTypeContext {
+			oldLineNo++
+			newLineNo++
+			i++
+			continue
+		}
+
+		// hunk range
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Type != GitDiffLineTypeContext {
+				end = j
+			} else if j-end > 2*contextLines {
+				break
+			}
+		}
+		stop := end + contextLines + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		// hunk
+		leading := i - start
+		h := GitDiffHunk{
+			OldStart: oldLineNo - leading,
+			NewStart: newLineNo - leading,
+			Lines:    lines[start:stop],
+		}
+		for _, l := range h.Lines {
+			if l.Type != GitDiffLineTypeAdd {
+				h.OldLines++
+			}
+			if l.Type != GitDiffLineTypeDelete {
+				h.NewLines++
+			}
+		}
+		oldLineNo += h.OldLines - leading
+		newLineNo += h.NewLines - leading
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		hunks = append(hunks, h)
+
+		i = stop
+	}
+
+	return hunks
+}
+
+// gitProgressWriter parses progress lines separated by "\r" or "\n" into GitProgress
+// for its handler. Lines not in a known format are ignored.
+type gitProgressWriter struct {
+	handler GitProgressHandler
+	buf     []byte
+}
+
+func newGitProgressWriter(handler GitProgressHandler) (w *gitProgressWriter) {
+	return &gitProgressWriter{handler: handler}
+}
+
+func (w *gitProgressWriter) Write(p []byte) (n int, err error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if progress, ok := parseGitProgress(line); ok {
+			w.handler(progress)
+		}
+	}
+	return len(p), nil
+}
+
+func parseGitProgress(line string) (progress GitProgress, ok bool) {
+	line = strings.TrimSpace(line)
+
+	// e.g. "Resolving deltas:  50% (5/10)"
+	if m := progressPercentRegexp.FindStringSubmatch(line); m != nil {
+		progress.Stage = m[1]
+		progress.Percent, _ = strconv.Atoi(m[2])
+		progress.Current, _ = strconv.Atoi(m[3])
+		progress.Total, _ = strconv.Atoi(m[4])
+		progress.Done = m[5] != ""
+		return progress, true
+	}
+
+	// e.g. "Enumerating objects: 52, done."
+	if m := progressCountRegexp.FindStringSubmatch(line); m != nil {
+		progress.Stage = m[1]
+		progress.Current, _ = strconv.Atoi(m[2])
+		progress.Done = m[3] != ""
+		if progress.Done {
+			progress.Total = progress.Current
+			progress.Percent = 100
+		}
+		return progress, true
+	}
+
+	return progress, false
+}
+
+func isSameFile(a, b *object.File) (ok bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func containsHash(hashes []plumbing.Hash, hash plumbing.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func getDiffFile(change *object.Change) (f GitDiffFile, err error) {
+	// paths and status
+	f.Path = change.To.Name
+	f.OldPath = change.From.Name
+	switch {
+	case change.From.Name == "":
+		f.Status = GitDiffStatusAdded
+	case change.To.Name == "":
+		f.Path = change.From.Name
+		f.Status = GitDiffStatusDeleted
+	default:
+		f.Status = GitDiffStatusModified
+	}
+
+	// modes (tree entries, empty on the missing side)
+	if change.From.Name != "" {
+		f.OldMode = getFileModeString(change.From.TreeEntry.Mode)
+	}
+	if change.To.Name != "" {
+		f.NewMode = getFileModeString(change.To.TreeEntry.Mode)
+	}
+	f.ModeChanged = f.Status == GitDiffStatusModified && f.OldMode != f.NewMode
+
+	// binary content (either side). Only flagged: text in legacy encodings such as
+	// GBK or Latin-1 is not valid UTF-8 but still gets hunks, which are suppressed
+	// only for content with null bytes, as by go-git
+	from, to, err := change.Files()
+	if err != nil {
+		return f, trace.TraceError(err)
+	}
+	for _, file := range []*object.File{from, to} {
+		if file == nil {
+			continue
+		}
+		isBinary, err := isBinaryFile(file)
+		if err != nil {
+			return f, err
+		}
+		if isBinary {
+			f.IsBinary = true
+		}
+	}
+
+	// hunks
+	patch, err := change.Patch()
+	if err != nil {
+		return f, trace.TraceError(err)
+	}
+	for _, fp := range patch.FilePatches() {
+		if fp.IsBinary() {
+			f.IsBinary = true
+			continue
+		}
+		f.Hunks = append(f.Hunks, getDiffHunks(fp.Chunks(), GitDiffContextLines)...)
+	}
+
+	return f, nil
+}
+
+// isPathUnderPrefix reports whether filePath, relative to the repo root, is prefix or
+// inside the directory prefix. An empty prefix matches any non-empty path.
+func isPathUnderPrefix(filePath, prefix string) bool {
+	if filePath == "" {
+		return false
+	}
+	prefix = strings.Trim(path.Clean("/"+filepath.ToSlash(prefix)), "/")
+	return prefix == "" || filePath == prefix || strings.HasPrefix(filePath, prefix+"/")
+}
+
+// matchPathPattern reports whether filePath, or one of its parent directories, matches
+// the glob pattern. The root pattern "." matches any path.
+func matchPathPattern(pattern, filePath string) (ok bool, err error) {
+	pattern = strings.Trim(path.Clean("/"+filepath.ToSlash(pattern)), "/")
+	if pattern == "" {
+		return true, nil
+	}
+	for p := filePath; p != "." && p != "/"; p = path.Dir(p) {
+		ok, err = path.Match(pattern, p)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// isBinaryFile applies IsBinaryContent to the leading bytes of the blob of file.
+func isBinaryFile(file *object.File) (ok bool, err error) {
+	reader, err := file.Blob.Reader()
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(reader, GitBinaryCheckSize))
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return IsBinaryContent(data), nil
+}
+
+// setAttributeValue records attr in attrs the way "git check-attr" prints it, removing
+// it if unspecified.
+func setAttributeValue(attrs map[string]string, attr gitattributes.Attribute) {
+	switch {
+	case attr.IsSet():
+		attrs[attr.Name()] = GitAttributeValueSet
+	case attr.IsUnset():
+		attrs[attr.Name()] = GitAttributeValueUnset
+	case attr.IsValueSet():
+		attrs[attr.Name()] = attr.Value()
+	default:
+		delete(attrs, attr.Name())
+	}
+}
+
+// getFileModeString formats a file mode the way git prints it, e.g. "100755".
+func getFileModeString(mode filemode.FileMode) string {
+	return strconv.FormatUint(uint64(mode), 8)
+}
+
+// parseMailmapIdentity parses "Name <email>", "<email>" or a bare email.
+func parseMailmapIdentity(identity string) (name, email string) {
+	m := mailmapIdentityRegexp.FindStringSubmatch(identity)
+	if m == nil {
+		return "", strings.TrimSpace(identity)
+	}
+	return m[1], m[2]
+}
+
+// getRealPath returns the absolute path of p with symlinks resolved, or only absolute
+// if p does not exist.
+func getRealPath(p string) (realPath string, err error) {
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	realPath, err = filepath.EvalSymlinks(absPath)
+	if os.IsNotExist(err) {
+		return absPath, nil
+	}
+	return realPath, err
+}
+
+// getFsError replaces errors of paths exceeding the os limits with ErrPathTooLong.
+func getFsError(err error) error {
+	if isPathTooLongError(err) {
+		return ErrPathTooLong
+	}
+	return err
+}
+
+// lineEdit replaces the lines [start, end) of a base content with lines.
+type lineEdit struct {
+	start int
+	end   int
+	lines []string
+}
+
+// splitLines splits content into lines keeping their line endings.
+func splitLines(content string) (lines []string) {
+	lines = strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// getLineEdits returns the edits turning the lines of base into those of content.
+func getLineEdits(base, content string) (edits []lineEdit) {
+	i := 0
+	var edit *lineEdit
+	for _, d := range utildiff.Do(base, content) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if edit != nil {
+				edits = append(edits, *edit)
+				edit = nil
+			}
+			i += len(lines)
+			continue
+		}
+		if edit == nil {
+			edit = &lineEdit{start: i, end: i}
+		}
+		if d.Type == diffmatchpatch.DiffDelete {
+			i += len(lines)
+			edit.end = i
+		} else {
+			edit.lines = append(edit.lines, lines...)
+		}
+	}
+	if edit != nil {
+		edits = append(edits, *edit)
+	}
+	return edits
+}
+
+// applyLineEdits returns the lines [start, end) of base with edits, which lie within
+// that range, applied.
+func applyLineEdits(base []string, start, end int, edits []lineEdit) (lines []string) {
+	for _, e := range edits {
+		lines = append(lines, base[start:e.start]...)
+		lines = append(lines, e.lines...)
+		start = e.end
+	}
+	return append(lines, base[start:end]...)
+}
+
+// mergeLines merges the changes of ours and theirs to base line by line, like a
+// three-way merge of git. Changes to different lines are all kept, and only changes
+// overlapping or adjacent to a change of the other side are resolved by taking the
+// side of strategy.
+func mergeLines(base, ours, theirs []byte, strategy string) (merged []byte) {
+	baseLines := splitLines(string(base))
+	oursEdits := getLineEdits(string(base), string(ours))
+	theirsEdits := getLineEdits(string(base), string(theirs))
+
+	var buf bytes.Buffer
+	pos := 0
+	for len(oursEdits) > 0 || len(theirsEdits) > 0 {
+		// group of edits overlapping or adjacent to each other
+		var start int
+		switch {
+		case len(oursEdits) == 0:
+			start = theirsEdits[0].start
+		case len(theirsEdits) == 0:
+			start = oursEdits[0].start
+		case oursEdits[0].start <= theirsEdits[0].start:
+			start = oursEdits[0].start
+		default:
+			start = theirsEdits[0].start
+		}
+		end := start
+		var o, t []lineEdit
+		for {
+			if len(oursEdits) > 0 && oursEdits[0].start <= end {
+				if oursEdits[0].end > end {
+					end = oursEdits[0].end
+				}
+				o = append(o, oursEdits[0])
+				oursEdits = oursEdits[1:]
+				continue
+			}
+			if len(theirsEdits) > 0 && theirsEdits[0].start <= end {
+				if theirsEdits[0].end > end {
+					end = theirsEdits[0].end
+				}
+				t = append(t, theirsEdits[0])
+				theirsEdits = theirsEdits[1:]
+				continue
+			}
+			break
+		}
+
+		// unchanged lines before the group
+		for _, line := range baseLines[pos:start] {
+			buf.WriteString(line)
+		}
+		pos = end
+
+		// lines of the group
+		oursLines := applyLineEdits(baseLines, start, end, o)
+		theirsLines := applyLineEdits(baseLines, start, end, t)
+		lines := oursLines
+		switch {
+		case len(o) == 0:
+			lines = theirsLines
+		case len(t) == 0:
+		case strings.Join(oursLines, "") == strings.Join(theirsLines, ""):
+		default:
+			if strategy == GitConflictStrategyTheirs {
+				lines = theirsLines
+			}
+		}
+		for _, line := range lines {
+			buf.WriteString(line)
+		}
+	}
+	for _, line := range baseLines[pos:] {
+		buf.WriteString(line)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package vcs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// getFileOwnerUid returns the uid of the owner of a file.
+func getFileOwnerUid(fi os.FileInfo) (uid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+// getLongPath returns p as is, long paths need no special handling on unix.
+func getLongPath(p string) string {
+	return p
+}
+
+func isPathTooLongError(err error) bool {
+	return errors.Is(err, syscall.ENAMETOOLONG)
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package vcs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// windowsMaxPath is MAX_PATH, the length limit of paths without the extended-length prefix.
+const windowsMaxPath = 260
+
+// windowsErrorFilenameExcedRange is ERROR_FILENAME_EXCED_RANGE.
+const windowsErrorFilenameExcedRange = syscall.Errno(206)
+
+// getFileOwnerUid is not supported on windows, where ownership is not checked.
+func getFileOwnerUid(fi os.FileInfo) (uid int, ok bool) {
+	return 0, false
+}
+
+// getLongPath adds the extended-length prefix to absolute paths over MAX_PATH.
+func getLongPath(p string) string {
+	if strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil || len(absPath) < windowsMaxPath {
+		return p
+	}
+	if strings.HasPrefix(absPath, `\\`) {
+		// UNC path
+		return `\\?\UNC\` + absPath[2:]
+	}
+	return `\\?\` + absPath
+}
+
+func isPathTooLongError(err error) bool {
+	return errors.Is(err, windowsErrorFilenameExcedRange) || errors.Is(err, syscall.ENAMETOOLONG)
+}